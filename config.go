@@ -0,0 +1,764 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// options holds everything that controls a scaneo run. Fields are set by
+// command line flags and, optionally, by a JSON config file.
+type options struct {
+	Output    string `json:"output,omitempty"`
+	Package   string `json:"package,omitempty"`
+	Unexport  bool   `json:"unexport,omitempty"`
+	Whitelist string `json:"whitelist,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	Driver    string `json:"driver,omitempty"`
+	Schema    string `json:"schema,omitempty"`
+	Funcs     string `json:"funcs,omitempty"`
+	BatchSize int    `json:"batchSize,omitempty"`
+	MaxParams int    `json:"maxParams,omitempty"`
+	RetryTx   int    `json:"retryTx,omitempty"`
+	MaxRows   int    `json:"maxRows,omitempty"`
+	CheckRows int    `json:"checkRows,omitempty"`
+	Repo      bool   `json:"repo,omitempty"`
+	Layout    string `json:"layout,omitempty"`
+	ByName    bool   `json:"byName,omitempty"`
+	Maps      bool   `json:"maps,omitempty"`
+	Stream    bool   `json:"stream,omitempty"`
+	Iter      bool   `json:"iter,omitempty"`
+	RowTo     bool   `json:"rowTo,omitempty"`
+	Fixtures  bool   `json:"fixtures,omitempty"`
+	NamedArgs bool   `json:"namedArgs,omitempty"`
+	MapFuncs  bool   `json:"mapFuncs,omitempty"`
+	Enums     bool   `json:"enums,omitempty"`
+	Squirrel  bool   `json:"squirrel,omitempty"`
+	Strict    bool   `json:"strict,omitempty"`
+	Validate  bool   `json:"validate,omitempty"`
+	Audit     bool   `json:"audit,omitempty"`
+	Otel      bool   `json:"otel,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Seed      int64  `json:"seed,omitempty"`
+
+	// LogQueries makes query helpers and repositories call the generated
+	// QueryLogger variable after each query.
+	LogQueries bool `json:"logQueries,omitempty"`
+
+	// WhitelistRegex includes structs whose name matches it, in addition
+	// to those -w lists.
+	WhitelistRegex string `json:"whitelistRegex,omitempty"`
+
+	// Exclude lists structs left out, even when whitelisted.
+	Exclude string `json:"exclude,omitempty"`
+
+	// Tags lists the build tags source files are matched against.
+	Tags string `json:"tags,omitempty"`
+
+	// QualifyNames prefixes the generated names of structs of different
+	// packages sharing a name with their package name.
+	QualifyNames bool `json:"qualifyNames,omitempty"`
+
+	// ContinueOnError skips unreadable paths of source directories with a
+	// warning instead of failing.
+	ContinueOnError bool `json:"continueOnError,omitempty"`
+
+	// SkipDirs lists names of subdirectories not walked, or none to walk
+	// them all. Empty skips defaultSkipDirs.
+	SkipDirs string `json:"skipDirs,omitempty"`
+
+	// FollowSymlinks walks symlinked subdirectories too.
+	FollowSymlinks bool `json:"followSymlinks,omitempty"`
+
+	// ExportedOnly skips unexported struct fields.
+	ExportedOnly bool `json:"exportedOnly,omitempty"`
+
+	// StrictFields fails parsing on fields of types scaneo can't scan,
+	// rather than skipping them with a warning.
+	StrictFields bool `json:"strictFields,omitempty"`
+
+	// UnknownColumns is the policy of name-based scan functions for
+	// columns no field matches: error, ignore or extra.
+	UnknownColumns string `json:"unknownColumns,omitempty"`
+
+	// BuildTag, when set, is the build constraint guarding the generated
+	// files.
+	BuildTag string `json:"-"`
+
+	// LooseTypes scans sqlite booleans and times through converters that
+	// accept the loose types SQLite stores them as.
+	LooseTypes bool `json:"looseTypes,omitempty"`
+
+	// QuoteIdentifiers quotes every table and column name in generated
+	// queries, not only reserved words.
+	QuoteIdentifiers bool `json:"quoteIdentifiers,omitempty"`
+
+	// Types maps a dialect name, or "default" for all dialects, to the type
+	// mapping tables used for that dialect.
+	Types map[string]typeMap `json:"types,omitempty"`
+
+	// Strategies declares custom scan strategies that can be referenced
+	// from the SQL type table.
+	Strategies map[string]strategy `json:"strategies,omitempty"`
+
+	// Timeouts maps read or write to the timeout of query helpers of that
+	// class, e.g. "2s". Structs override them with //scaneo:timeout.
+	Timeouts map[string]string `json:"timeouts,omitempty"`
+
+	// Money configures the type fields tagged money are scanned into.
+	Money moneyType `json:"money,omitempty"`
+}
+
+// moneyType describes a money type built from integer cents.
+type moneyType struct {
+	// Type is the money type as written in the source file.
+	Type string `json:"type,omitempty"`
+
+	// FromCents builds a value from cents %[1]s and currency code %[2]q,
+	// e.g. "money.New(%[1]s, %[2]q)".
+	FromCents string `json:"fromCents,omitempty"`
+
+	// ToCents returns the cents of value %s, e.g. "%s.Amount()".
+	ToCents string `json:"toCents,omitempty"`
+
+	// Currency is the currency code used unless a field overrides it with
+	// a currency tag option.
+	Currency string `json:"currency,omitempty"`
+
+	Imports []string `json:"imports,omitempty"`
+}
+
+// typeMap is a pair of type mapping tables.
+type typeMap struct {
+	// Go maps a Go type, as written in the source file, to its SQL type.
+	Go map[string]string `json:"go"`
+
+	// SQL maps a SQL type to the name of the strategy used to scan it.
+	SQL map[string]string `json:"sql"`
+}
+
+// strategy describes how a column value is scanned into a struct field.
+type strategy struct {
+	// Temp is the type of an intermediate variable to scan into. An empty
+	// Temp scans straight into the field.
+	Temp string `json:"temp"`
+
+	// Scan converts the intermediate variable %[1]s into the field type
+	// %[2]s, e.g. "%[2]s(%[1]s)".
+	Scan string `json:"scan"`
+
+	// Dest wraps the pointer %s passed to Scan, e.g. "wkb.Scanner(%s)".
+	Dest string `json:"dest"`
+
+	// Column wraps the column %s in select lists, e.g. "ST_AsBinary(%s)".
+	Column string `json:"column"`
+
+	// Value converts the field %s into a query argument, e.g.
+	// "wkb.Value(%s)".
+	Value string `json:"value"`
+
+	// Bind wraps the placeholder %s in inserts and updates, e.g.
+	// "ST_GeomFromWKB(%s)".
+	Bind string `json:"bind"`
+
+	// Imports lists packages the generated conversion refers to.
+	Imports []string `json:"imports"`
+
+	// Helper names the support code a builtin strategy emits once per
+	// generated file.
+	Helper string `json:"-"`
+}
+
+// helpers lists the query helpers that can be requested with -funcs.
+var helpers = []string{"select", "get", "find", "search", "list", "count", "exists", "insert", "upsert", "update", "delete", "batch", "copy", "queue", "prepare"}
+
+// impliedBy maps a helper to the helpers that build on it.
+var impliedBy = map[string][]string{
+	"select": {"get", "find", "search", "list", "queue", "prepare"},
+}
+
+var unknownColumnPolicies = []string{"error", "ignore", "extra"}
+
+// repoNeeds lists the helpers repositories generated with -repo build on.
+var repoNeeds = []string{"select"}
+
+var builtinStrategies = map[string]strategy{
+	"direct": {},
+	"text":   {Temp: "string", Scan: "%[2]s(%[1]s)"},
+	"bytes":  {Temp: "[]byte", Scan: "%[2]s(%[1]s)"},
+	"wkb": {
+		Dest:    "wkb.Scanner(%s)",
+		Column:  "ST_AsBinary(%s)",
+		Value:   "wkb.Value(%s)",
+		Bind:    "ST_GeomFromWKB(%s)",
+		Imports: []string{"github.com/paulmach/orb/encoding/wkb"},
+	},
+	"ewkb": {
+		Dest:    "ewkb.Scanner(%s)",
+		Column:  "ST_AsEWKB(%s)",
+		Value:   "ewkb.Value(%s, 4326)",
+		Bind:    "ST_GeomFromEWKB(%s)",
+		Imports: []string{"github.com/paulmach/orb/encoding/ewkb"},
+	},
+	"interval": {
+		Temp:    "float64",
+		Scan:    "time.Duration(math.Round(%[1]s*1e6)) * time.Microsecond",
+		Column:  "EXTRACT(EPOCH FROM %s)",
+		Value:   `fmt.Sprintf("%%d microseconds", %s.Microseconds())`,
+		Imports: []string{"fmt", "math", "time"},
+	},
+	"hstore": {
+		Temp:    "pgtype.Hstore",
+		Scan:    "hstoreToMap(%[1]s)",
+		Value:   "mapToHstore(%s)",
+		Imports: []string{"github.com/jackc/pgx/v5/pgtype"},
+		Helper:  "hstore",
+	},
+	// pgtype fields under -driver pgx, which scans them natively
+	"pgtype": {
+		Imports: []string{"github.com/jackc/pgx/v5/pgtype"},
+	},
+	"int64": {
+		Temp:  "int64",
+		Scan:  "%[2]s(%[1]s)",
+		Value: "int64(%s)",
+	},
+	"pqArray": {
+		Dest:    "pq.Array(%s)",
+		Value:   "pq.Array(%s)",
+		Imports: []string{"github.com/lib/pq"},
+	},
+	"sqliteBool": {
+		Dest:   "(*sqliteBool)(%s)",
+		Helper: "sqliteBool",
+	},
+	"sqliteTime": {
+		Dest:   "(*sqliteTime)(%s)",
+		Helper: "sqliteTime",
+	},
+}
+
+// builtinTypes are the type mapping tables scaneo ships with. The
+// "default" tables apply to every dialect; the tables of the selected
+// dialect are layered on top, then those of the selected driver, followed
+// by those from the config file.
+var builtinTypes = map[string]typeMap{
+	"default": {
+		Go: map[string]string{
+			"bool":      "boolean",
+			"string":    "text",
+			"[]byte":    "blob",
+			"int":       "bigint",
+			"int8":      "smallint",
+			"int16":     "smallint",
+			"int32":     "integer",
+			"int64":     "bigint",
+			"uint8":     "smallint",
+			"uint16":    "integer",
+			"uint32":    "bigint",
+			"float32":   "real",
+			"float64":   "double precision",
+			"time.Time": "timestamp",
+
+			"time.Duration": "bigint",
+
+			"orb.Geometry":        "geometry",
+			"orb.Point":           "geometry",
+			"orb.MultiPoint":      "geometry",
+			"orb.LineString":      "geometry",
+			"orb.MultiLineString": "geometry",
+			"orb.Ring":            "geometry",
+			"orb.Polygon":         "geometry",
+			"orb.MultiPolygon":    "geometry",
+			"orb.Collection":      "geometry",
+		},
+		SQL: map[string]string{
+			"geometry":  "wkb",
+			"geography": "wkb",
+			"hstore":    "hstore",
+			"interval":  "interval",
+		},
+	},
+	"postgres": {
+		Go: map[string]string{
+			"[]byte":            "bytea",
+			"time.Time":         "timestamptz",
+			"map[string]string": "hstore",
+			"time.Duration":     "interval",
+
+			"[]bool":    "boolean[]",
+			"[]int32":   "integer[]",
+			"[]int64":   "bigint[]",
+			"[]float32": "real[]",
+			"[]float64": "double precision[]",
+			"[]string":  "text[]",
+			"[][]byte":  "bytea[]",
+		},
+		SQL: map[string]string{
+			"boolean[]":          "pqArray",
+			"integer[]":          "pqArray",
+			"bigint[]":           "pqArray",
+			"real[]":             "pqArray",
+			"double precision[]": "pqArray",
+			"text[]":             "pqArray",
+			"bytea[]":            "pqArray",
+		},
+	},
+	// layered on top of the dialect tables with -driver pgx, which scans
+	// arrays natively
+	"pgx": {
+		SQL: map[string]string{
+			"boolean[]":          "direct",
+			"integer[]":          "direct",
+			"bigint[]":           "direct",
+			"real[]":             "direct",
+			"double precision[]": "direct",
+			"text[]":             "direct",
+			"bytea[]":            "direct",
+		},
+	},
+	// layered on top of the dialect tables with -driver spanner, which only
+	// decodes 64-bit integers
+	"spanner": {
+		Go: map[string]string{
+			"int":    "INT64",
+			"int8":   "INT64",
+			"int16":  "INT64",
+			"int32":  "INT64",
+			"uint8":  "INT64",
+			"uint16": "INT64",
+			"uint32": "INT64",
+		},
+		SQL: map[string]string{
+			"INT64": "int64",
+		},
+	},
+	"mysql": {
+		Go: map[string]string{
+			"bool":      "tinyint(1)",
+			"float64":   "double",
+			"time.Time": "datetime",
+		},
+	},
+	"sqlite": {
+		Go: map[string]string{
+			"time.Time": "datetime",
+		},
+	},
+	"clickhouse": {
+		Go: map[string]string{
+			"bool":      "Bool",
+			"string":    "String",
+			"[]byte":    "String",
+			"int":       "Int64",
+			"int8":      "Int8",
+			"int16":     "Int16",
+			"int32":     "Int32",
+			"int64":     "Int64",
+			"uint8":     "UInt8",
+			"uint16":    "UInt16",
+			"uint32":    "UInt32",
+			"uint64":    "UInt64",
+			"float32":   "Float32",
+			"float64":   "Float64",
+			"time.Time": "DateTime64(3)",
+
+			"[]string":  "Array(String)",
+			"[]int32":   "Array(Int32)",
+			"[]int64":   "Array(Int64)",
+			"[]float64": "Array(Float64)",
+		},
+	},
+	// layered on top of the sqlite tables with -loose-types
+	"sqlite-loose": {
+		SQL: map[string]string{
+			"boolean":  "sqliteBool",
+			"datetime": "sqliteTime",
+		},
+	},
+}
+
+func loadConfig(path string, opts *options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opts); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	for name := range opts.Strategies {
+		if _, exists := builtinStrategies[name]; exists {
+			return fmt.Errorf("%s: strategy %q shadows a builtin strategy", path, name)
+		}
+	}
+
+	return nil
+}
+
+// check reports options that can't be acted on.
+func (o *options) check() error {
+	for _, dialect := range o.dialectList() {
+		if _, known := dialects[dialect]; !known {
+			names := make([]string, 0, len(dialects))
+			for name := range dialects {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			return fmt.Errorf("unknown dialect %q, expected one of %s", dialect, strings.Join(names, ", "))
+		}
+	}
+
+	if _, known := drivers[o.Driver]; !known {
+		names := make([]string, 0, len(drivers))
+		for name := range drivers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return fmt.Errorf("unknown driver %q, expected one of %s", o.Driver, strings.Join(names, ", "))
+	}
+
+	if o.Driver == "pgx" {
+		for _, dialect := range o.dialectList() {
+			if dialect != "postgres" {
+				return fmt.Errorf("the pgx driver doesn't support the %s dialect", dialect)
+			}
+		}
+		if o.Wants("prepare") {
+			return errors.New("prepare helpers need the database/sql driver")
+		}
+	}
+
+	if o.Driver == "spanner" || o.Driver == "gocql" {
+		if len(o.funcList()) > 0 || o.Repo {
+			return fmt.Errorf("the %s driver has no query helpers or repositories", o.Driver)
+		}
+		unsupported := map[string]bool{"by-name": o.ByName, "maps": o.Maps, "stream": o.Stream, "iter": o.Iter,
+			"row-to": o.RowTo, "named-args": o.NamedArgs, "squirrel": o.Squirrel, "otel": o.Otel, "max-rows": o.MaxRows > 0,
+			"check-rows": o.CheckRows > 0, "strict": o.Strict, "audit": o.Audit, "log-queries": o.LogQueries,
+			"layout split": o.Layout == "split"}
+		for _, flag := range []string{"by-name", "maps", "stream", "iter", "row-to", "named-args", "squirrel", "otel",
+			"max-rows", "check-rows", "strict", "audit", "log-queries", "layout split"} {
+			if unsupported[flag] {
+				return fmt.Errorf("the %s driver doesn't support -%s", o.Driver, flag)
+			}
+		}
+	}
+
+	if o.Driver == "sqlx" {
+		for _, dialect := range o.dialectList() {
+			if dialect == "oracle" || dialect == "clickhouse" {
+				return fmt.Errorf("the sqlx driver doesn't support the %s dialect", dialect)
+			}
+		}
+	}
+
+	if _, err := o.structFilter(); err != nil {
+		return err
+	}
+
+	for _, fn := range o.funcList() {
+		if !contains(helpers, fn) {
+			return fmt.Errorf("unknown helper %q, expected one of %s", fn, strings.Join(helpers, ", "))
+		}
+	}
+
+	if (len(o.funcList()) > 0 || o.Repo) && o.Dialect == "" {
+		return errors.New("query helpers need a dialect")
+	}
+
+	if o.LooseTypes && !contains(o.dialectList(), "sqlite") {
+		return errors.New("loose types need the sqlite dialect")
+	}
+
+	for _, dialect := range o.dialectList() {
+		if o.Wants("queue") && dialect != "postgres" {
+			return errors.New("queue helpers need the postgres dialect")
+		}
+
+		if o.Wants("copy") && dialect != "postgres" {
+			return errors.New("copy helpers need the postgres dialect")
+		}
+
+		if o.Wants("upsert") && (dialect == "mssql" || dialect == "oracle") {
+			return fmt.Errorf("upsert helpers don't support the %s dialect", dialect)
+		}
+
+		if o.Wants("batch") && dialect == "oracle" {
+			return errors.New("batch helpers don't support the oracle dialect")
+		}
+
+		if dialect == "clickhouse" {
+			// rows are changed by asynchronous mutations, not statements
+			for _, fn := range []string{"upsert", "update", "delete", "prepare"} {
+				if o.Wants(fn) {
+					return fmt.Errorf("%s helpers don't support the clickhouse dialect", fn)
+				}
+			}
+			if o.Repo {
+				return errors.New("repositories don't support the clickhouse dialect")
+			}
+		}
+	}
+
+	for class, timeout := range o.Timeouts {
+		if class != "read" && class != "write" {
+			return fmt.Errorf("unknown timeout class %q, expected read or write", class)
+		}
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return fmt.Errorf("invalid %s timeout %q", class, timeout)
+		}
+	}
+
+	if o.BatchSize < 1 {
+		return fmt.Errorf("batch size must be positive, got %d", o.BatchSize)
+	}
+
+	if o.RetryTx < 0 {
+		return fmt.Errorf("transaction retries can't be negative, got %d", o.RetryTx)
+	}
+
+	if o.RetryTx > 0 && !o.Repo {
+		return errors.New("transaction retries need -repo")
+	}
+
+	if o.MaxParams < 0 {
+		return fmt.Errorf("max params can't be negative, got %d", o.MaxParams)
+	}
+
+	if o.Layout != "single" && o.Layout != "split" {
+		return fmt.Errorf("unknown layout %q, expected single or split", o.Layout)
+	}
+
+	if o.Output == "-" && (o.Layout == "split" || len(o.dialectList()) > 1) {
+		return errors.New("stdout takes a single file, not a split layout or a file per dialect")
+	}
+
+	if !contains(unknownColumnPolicies, o.UnknownColumns) {
+		return fmt.Errorf("unknown columns policy %q, expected one of %s",
+			o.UnknownColumns, strings.Join(unknownColumnPolicies, ", "))
+	}
+
+	if o.Summary != "" && o.Summary != "text" && o.Summary != "json" {
+		return fmt.Errorf("unknown summary format %q, expected text or json", o.Summary)
+	}
+
+	if o.MaxRows < 0 {
+		return fmt.Errorf("max rows can't be negative, got %d", o.MaxRows)
+	}
+
+	if o.CheckRows < 0 {
+		return fmt.Errorf("check rows can't be negative, got %d", o.CheckRows)
+	}
+
+	return nil
+}
+
+// defaultSkipDirs are the subdirectories of sources not walked unless
+// -skip-dirs says otherwise.
+const defaultSkipDirs = "vendor,testdata,.git"
+
+// skipDirs returns the names of the subdirectories of sources not walked.
+func (o *options) skipDirs() []string {
+	switch o.SkipDirs {
+	case "":
+		return strings.Split(defaultSkipDirs, ",")
+	case "none":
+		return nil
+	}
+
+	return strings.Split(o.SkipDirs, ",")
+}
+
+func (o *options) funcList() []string {
+	if o.Funcs == "" {
+		return nil
+	}
+
+	return strings.Split(o.Funcs, ",")
+}
+
+// dialectList returns the requested dialects, of which there may be
+// several, each generated to its own file.
+func (o *options) dialectList() []string {
+	if o.Dialect == "" {
+		return nil
+	}
+
+	return strings.Split(o.Dialect, ",")
+}
+
+// perDialect returns the options of each file to generate: o itself for
+// one dialect or none, or else a copy per dialect writing to a file named
+// after it and guarded by a build tag of the same name.
+func (o *options) perDialect() []options {
+	list := o.dialectList()
+	if len(list) < 2 {
+		return []options{*o}
+	}
+
+	perDialect := make([]options, len(list))
+	for i, dialect := range list {
+		perDialect[i] = *o
+		perDialect[i].Dialect = dialect
+		perDialect[i].Output = partFile(o.Output, dialect)
+		perDialect[i].BuildTag = dialect
+	}
+
+	return perDialect
+}
+
+// Wants reports whether the query helper fn was requested, directly or
+// through a helper that builds on it.
+func (o *options) Wants(fn string) bool {
+	if contains(o.funcList(), fn) {
+		return true
+	}
+	if o.Repo && contains(repoNeeds, fn) {
+		return true
+	}
+
+	for _, dependent := range impliedBy[fn] {
+		if o.Wants(dependent) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// name builds the name of a generated declaration from its parts, e.g.
+// Get and user become GetUser, or getUser when unexporting.
+func (o *options) name(parts ...string) string {
+	var name string
+	for _, p := range parts {
+		name += strings.Title(p)
+	}
+
+	if o.Unexport {
+		return lowerInitial(name)
+	}
+
+	return name
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup searches the type tables for key, most specific first.
+func (o *options) lookup(table func(typeMap) map[string]string, key string) (string, bool) {
+	sources := []map[string]typeMap{o.Types, builtinTypes}
+	tables := []string{o.Dialect, "default"}
+	if o.Driver != "" && o.Driver != "database/sql" {
+		tables = append([]string{o.Driver}, tables...)
+	}
+	if o.LooseTypes && o.Dialect == "sqlite" {
+		tables = append([]string{"sqlite-loose"}, tables...)
+	}
+	for _, src := range sources {
+		for _, dialect := range tables {
+			if dialect == "" {
+				continue
+			}
+
+			if v, ok := table(src[dialect])[key]; ok {
+				return v, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// sqlType returns the SQL type a Go type is stored as, or an empty string
+// when the type isn't in any table.
+func (o *options) sqlType(goType string) string {
+	sqlType, _ := o.lookup(func(m typeMap) map[string]string { return m.Go }, goType)
+	return sqlType
+}
+
+// strategy returns the strategy used to scan columns of sqlType. Types
+// missing from the tables are scanned directly.
+func (o *options) strategy(sqlType string) (strategy, error) {
+	name, ok := o.lookup(func(m typeMap) map[string]string { return m.SQL }, sqlType)
+	if !ok {
+		return builtinStrategies["direct"], nil
+	}
+
+	if strat, exists := builtinStrategies[name]; exists {
+		return strat, nil
+	}
+	if strat, exists := o.Strategies[name]; exists {
+		return strat, nil
+	}
+
+	return strategy{}, fmt.Errorf("unknown strategy %q for SQL type %q", name, sqlType)
+}
+
+// scansMap reports whether strat scans columns into map fields of goType.
+// Drivers scan into no maps themselves, and the hstore strategy only yields
+// the map[string]string of postgres hstore columns.
+func (o *options) scansMap(goType string, strat strategy) bool {
+	if strat.Helper == "hstore" {
+		return o.Dialect == "postgres" && goType == "map[string]string"
+	}
+
+	return strat.Temp != "" || strat.Dest != ""
+}
+
+// moneyStrategy returns the strategy for a field of goType tagged money.
+// Money is stored as integer cents, so it never passes through a float.
+func (o *options) moneyStrategy(goType, currency string) (strategy, error) {
+	switch strings.TrimPrefix(goType, "*") {
+	case "int", "int32", "int64":
+		return builtinStrategies["direct"], nil
+	case "float32", "float64":
+		return strategy{}, fmt.Errorf("money can't be a floating point %s, use integer cents", goType)
+	case o.Money.Type:
+		if currency == "" {
+			currency = o.Money.Currency
+		}
+		if currency == "" {
+			return strategy{}, errors.New("money needs a currency, set one in the config or with a currency tag option")
+		}
+
+		if !strings.HasPrefix(goType, "*") {
+			return strategy{
+				Temp:    "int64",
+				Scan:    fmt.Sprintf(o.Money.FromCents, "%[1]s", currency),
+				Value:   o.Money.ToCents,
+				Imports: o.Money.Imports,
+			}, nil
+		}
+
+		// a NULL column scans into a nil pointer, and a nil pointer is
+		// stored as NULL, instead of calling into the money type
+		fromCents := fmt.Sprintf(o.Money.FromCents, "*%[1]s", currency)
+		toCents := fmt.Sprintf(o.Money.ToCents, "(*%[1]s)")
+		return strategy{
+			Temp:    "*int64",
+			Scan:    "func() %[2]s { if %[1]s == nil { return nil }; m := " + fromCents + "; return &m }()",
+			Value:   "func() *int64 { if %[1]s == nil { return nil }; c := int64(" + toCents + "); return &c }()",
+			Imports: o.Money.Imports,
+		}, nil
+	}
+
+	return strategy{}, fmt.Errorf("money must be integer cents or %s, got %s", o.Money.Type, goType)
+}
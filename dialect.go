@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect describes the SQL flavor generated queries are written in.
+type dialect struct {
+	// bindVar is the placeholder prefix, e.g. $, @p or ?.
+	bindVar string
+
+	// numbered reports whether placeholders carry their position, e.g. $1.
+	numbered bool
+
+	// onDuplicateKey reports whether upserts use MySQL's ON DUPLICATE KEY
+	// UPDATE rather than ON CONFLICT.
+	onDuplicateKey bool
+
+	// citext reports whether the citext column type is available.
+	citext bool
+
+	// nocase reports whether case-insensitive comparisons use COLLATE
+	// NOCASE rather than LOWER.
+	nocase bool
+
+	// returning reports whether inserts can return generated keys, with a
+	// RETURNING clause or, on SQL Server, an OUTPUT INSERTED clause.
+	returning bool
+
+	// outputInserted reports whether generated keys are returned with
+	// OUTPUT INSERTED rather than RETURNING.
+	outputInserted bool
+
+	// returningInto reports whether inserts return generated keys into an
+	// output argument with RETURNING ... INTO, as on Oracle.
+	returningInto bool
+
+	// dual reports whether selects without a table select from DUAL.
+	dual bool
+
+	// offsetFetch reports whether pagination uses OFFSET n ROWS FETCH NEXT
+	// m ROWS ONLY rather than LIMIT and OFFSET.
+	offsetFetch bool
+
+	// prepareBatch reports whether batch inserts append rows to a
+	// clickhouse-go batch rather than building multi-row inserts.
+	prepareBatch bool
+
+	// maxParams is the number of parameters a statement can take.
+	maxParams int
+
+	// maxValues, when set, is the number of rows a VALUES list can hold.
+	maxValues int
+
+	// quotes are the characters opening and closing quoted identifiers,
+	// e.g. [] on SQL Server.
+	quotes string
+
+	// quoteAll reports whether every identifier is quoted, rather than
+	// only reserved words.
+	quoteAll bool
+
+	// lastInsertID reports whether the driver returns generated keys with
+	// sql.Result's LastInsertId.
+	lastInsertID bool
+
+	// fullText is the full-text search flavor, tsvector or match, or empty
+	// if generated helpers can't search.
+	fullText string
+}
+
+var dialects = map[string]dialect{
+	"postgres":   {bindVar: "$", numbered: true, citext: true, returning: true, maxParams: 65535, quotes: `""`, fullText: "tsvector"},
+	"mysql":      {bindVar: "?", onDuplicateKey: true, lastInsertID: true, maxParams: 65535, quotes: "``", fullText: "match"},
+	"sqlite":     {bindVar: "?", nocase: true, lastInsertID: true, maxParams: 32766, quotes: `""`},
+	"mssql":      {bindVar: "@p", numbered: true, returning: true, outputInserted: true, offsetFetch: true, maxParams: 2100, maxValues: 1000, quotes: "[]"},
+	"oracle":     {bindVar: ":", numbered: true, returningInto: true, dual: true, offsetFetch: true, maxParams: 65535, quotes: `""`},
+	"clickhouse": {bindVar: "?", prepareBatch: true, quotes: "``"},
+}
+
+// reserved lists common SQL reserved words, which are quoted when used as
+// table or column names.
+var reserved = map[string]bool{
+	"all": true, "and": true, "as": true, "by": true, "case": true,
+	"check": true, "column": true, "constraint": true, "create": true,
+	"default": true, "delete": true, "desc": true, "distinct": true,
+	"drop": true, "else": true, "end": true, "from": true, "grant": true,
+	"group": true, "having": true, "in": true, "index": true, "insert": true,
+	"into": true, "is": true, "join": true, "key": true, "like": true,
+	"limit": true, "not": true, "null": true, "offset": true, "on": true,
+	"or": true, "order": true, "primary": true, "references": true,
+	"select": true, "table": true, "then": true, "to": true, "union": true,
+	"unique": true, "update": true, "user": true, "using": true,
+	"values": true, "when": true, "where": true, "with": true,
+}
+
+// Placeholder returns the placeholder for the nth (1-based) query argument.
+func (d dialect) Placeholder(n int) string {
+	if !d.numbered {
+		return d.bindVar
+	}
+
+	return d.bindVar + strconv.Itoa(n)
+}
+
+// placeholderExpr returns a Go expression of the placeholder for the
+// query argument numbered by the Go expression n.
+func (d dialect) placeholderExpr(n string) string {
+	if !d.numbered {
+		return strconv.Quote(d.bindVar)
+	}
+
+	return fmt.Sprintf("%q + strconv.Itoa(%s)", d.bindVar, n)
+}
+
+// equals returns a predicate comparing the column of f to the nth query
+// argument. Fields tagged ci or citext compare case-insensitively.
+func (d dialect) equals(f fieldToken, n int) string {
+	_, ci := f.Opts["ci"]
+	citext := f.SQLType == "citext"
+	ph := f.BindExpr(d, n)
+
+	switch {
+	case citext && d.citext, !ci && !citext:
+		return fmt.Sprintf("%s = %s", d.ident(f.Column), ph)
+	case d.nocase:
+		return fmt.Sprintf("%s = %s COLLATE NOCASE", d.ident(f.Column), ph)
+	}
+
+	return fmt.Sprintf("LOWER(%s) = LOWER(%s)", d.ident(f.Column), ph)
+}
+
+// paginate returns an ORDER BY clause on column followed by a limit of
+// the nth query argument and, unless offset is zero, an offset of the
+// offset-th argument.
+func (d dialect) paginate(column string, limit, offset int) string {
+	if d.offsetFetch {
+		skip := "0"
+		if offset != 0 {
+			skip = d.Placeholder(offset)
+		}
+
+		return fmt.Sprintf(" ORDER BY %s OFFSET %s ROWS FETCH NEXT %s ROWS ONLY",
+			d.ident(column), skip, d.Placeholder(limit))
+	}
+
+	clause := fmt.Sprintf(" ORDER BY %s LIMIT %s", d.ident(column), d.Placeholder(limit))
+	if offset == 0 {
+		return clause
+	}
+
+	return clause + " OFFSET " + d.Placeholder(offset)
+}
+
+// exists returns a query selecting whether query returns any row.
+func (d dialect) exists(query string) string {
+	if d.offsetFetch {
+		// SQL Server and Oracle have no boolean expressions in select lists
+		query = fmt.Sprintf("SELECT CASE WHEN EXISTS (%s) THEN 1 ELSE 0 END", query)
+		if d.dual {
+			query += " FROM DUAL"
+		}
+		return query
+	}
+
+	return fmt.Sprintf("SELECT EXISTS (%s)", query)
+}
+
+// ident returns name quoted as an identifier when it's a reserved word,
+// or always with quoteAll. Each part of qualified names, e.g.
+// schema.table, is quoted on its own.
+func (d dialect) ident(name string) string {
+	if d.quotes == "" {
+		return name
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if d.quoteAll || reserved[strings.ToLower(part)] {
+			parts[i] = d.quotes[:1] + part + d.quotes[1:]
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// columns returns the column names of tok in scan order, quoted as
+// identifiers where needed.
+func (d dialect) columns(tok structToken) []string {
+	cols := tok.Columns()
+	for i := range cols {
+		cols[i] = d.ident(cols[i])
+	}
+
+	return cols
+}
+
+// createColumns returns the quoted columns of tok an insert supplies,
+// leaving out an auto-generated primary key.
+func (d dialect) createColumns(tok structToken) []string {
+	fields := tok.createFields()
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		cols[i] = d.ident(f.Column)
+	}
+
+	return cols
+}
+
+// selectList returns the comma-separated select expressions of tok in
+// scan order.
+func (d dialect) selectList(tok structToken) string {
+	exprs := make([]string, len(tok.Fields))
+	for i, f := range tok.Fields {
+		exprs[i] = f.SelectExpr(d)
+	}
+
+	return strings.Join(exprs, ", ")
+}
+
+// searchSQL returns a query selecting rows of tok whose fts fields match
+// the query argument, most relevant first, followed by the rank when tok
+// has a rank field. Arguments are those listed by searchArgs.
+func (d dialect) searchSQL(tok structToken) string {
+	var cols []string
+	for _, f := range tok.FullText() {
+		cols = append(cols, d.ident(f.Column))
+	}
+
+	var match, rank string
+	switch d.fullText {
+	case "tsvector":
+		var doc string
+		if len(cols) == 1 && tok.FullText()[0].SQLType == "tsvector" {
+			doc = cols[0]
+		} else {
+			for i, col := range cols {
+				cols[i] = fmt.Sprintf("coalesce(%s, '')", col)
+			}
+			doc = fmt.Sprintf("to_tsvector(%s)", strings.Join(cols, " || ' ' || "))
+		}
+
+		match = fmt.Sprintf("%s @@ plainto_tsquery(%s)", doc, d.Placeholder(1))
+		rank = fmt.Sprintf("ts_rank(%s, plainto_tsquery(%s))", doc, d.Placeholder(1))
+	case "match":
+		match = fmt.Sprintf("MATCH (%s) AGAINST (%s)", strings.Join(cols, ", "), d.Placeholder(1))
+		rank = match
+	}
+
+	list := d.selectList(tok)
+	if tok.Rank != nil {
+		list += ", " + rank
+	}
+
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s DESC LIMIT %s",
+		list, d.ident(tok.Table), match, rank, d.Placeholder(len(d.searchArgs(tok))))
+}
+
+// searchArgs returns the arguments of searchSQL.
+func (d dialect) searchArgs(tok structToken) []string {
+	if d.numbered {
+		return []string{"query", "limit"}
+	}
+
+	args := []string{"query", "query"}
+	if tok.Rank != nil {
+		args = append(args, "query")
+	}
+
+	return append(args, "limit")
+}
+
+// batchRow returns a Go statement writing one parenthesized row of
+// placeholders for tok to the strings.Builder b, where p is the number of
+// arguments preceding the row.
+func (d dialect) batchRow(tok structToken) string {
+	verb := d.bindVar
+	if d.numbered {
+		verb += "%d"
+	}
+
+	fields := tok.createFields()
+	binds := make([]string, len(fields))
+	nums := make([]string, len(fields))
+	for i, f := range fields {
+		binds[i] = verb
+		if f.Strategy.Bind != "" {
+			binds[i] = fmt.Sprintf(f.Strategy.Bind, verb)
+		}
+		nums[i] = fmt.Sprintf("p+%d", i+1)
+	}
+
+	row := "(" + strings.Join(binds, ", ") + ")"
+	if !d.numbered {
+		return fmt.Sprintf("b.WriteString(%q)", row)
+	}
+
+	return fmt.Sprintf("fmt.Fprintf(&b, %q, %s)", row, strings.Join(nums, ", "))
+}
+
+// rowsPerInsert returns how many rows of tok a batch insert takes: at
+// most batchSize, and no more than fit in maxParams parameters, or the
+// dialect's limit when maxParams is zero, nor in a VALUES list.
+func (d dialect) rowsPerInsert(tok structToken, batchSize, maxParams int) int {
+	if maxParams == 0 {
+		maxParams = d.maxParams
+	}
+
+	rows := batchSize
+	if fit := maxParams / len(tok.createFields()); fit < rows {
+		rows = fit
+	}
+	if d.maxValues > 0 && d.maxValues < rows {
+		rows = d.maxValues
+	}
+	if rows < 1 {
+		// a row wider than the limit fails on its own
+		rows = 1
+	}
+
+	return rows
+}
+
+// insertSQL returns an INSERT of every column of tok.
+func (d dialect) insertSQL(tok structToken) string {
+	binds := make([]string, len(tok.Fields))
+	for i, f := range tok.Fields {
+		binds[i] = f.BindExpr(d, i+1)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		d.ident(tok.Table), strings.Join(d.columns(tok), ", "), strings.Join(binds, ", "))
+}
+
+// updateSQL returns an UPDATE of every column of tok but the primary key,
+// matching the row by primary key. The key is the last argument, but for
+// versioned rows, which are matched by version too and increment it.
+func (d dialect) updateSQL(tok structToken) string {
+	pk := tok.PK()
+
+	var sets []string
+	for _, f := range tok.Fields {
+		if f.PK || f.Version() {
+			continue
+		}
+
+		sets = append(sets, fmt.Sprintf("%s = %s", d.ident(f.Column), f.BindExpr(d, len(sets)+1)))
+	}
+
+	n := len(sets)
+	version := tok.VersionField()
+	if version == nil {
+		if n == 0 {
+			sets = append(sets, fmt.Sprintf("%s = %s", d.ident(pk.Column), d.ident(pk.Column)))
+		}
+
+		return fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+			d.ident(tok.Table), strings.Join(sets, ", "), d.equals(*pk, n+1))
+	}
+
+	// optimistic locking, the update only applies to the version read
+	sets = append(sets, fmt.Sprintf("%s = %s + 1", d.ident(version.Column), d.ident(version.Column)))
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s AND %s",
+		d.ident(tok.Table), strings.Join(sets, ", "), d.equals(*pk, n+1), d.equals(*version, n+2))
+}
+
+// named returns the query build writes for tok with sqlx's :column
+// parameters in place of the placeholders of args, which are fields in
+// argument order.
+func (d dialect) named(build func(dialect, structToken) string, tok structToken, args []fieldToken) string {
+	sentinel := d
+	sentinel.bindVar, sentinel.numbered = "\x00", true
+
+	query := build(sentinel, tok)
+	for n := len(args); n > 0; n-- {
+		// last first, so that replacing 1 leaves 10 alone
+		query = strings.Replace(query, sentinel.Placeholder(n), ":"+args[n-1].Column, -1)
+	}
+
+	return query
+}
+
+// createSQL returns an INSERT of every column of tok but an auto-generated
+// primary key, which is returned on dialects that can.
+func (d dialect) createSQL(tok structToken) string {
+	var cols, binds []string
+	for _, f := range tok.Fields {
+		if f.PK && f.Auto() {
+			continue
+		}
+
+		cols = append(cols, d.ident(f.Column))
+		binds = append(binds, f.BindExpr(d, len(binds)+1))
+	}
+
+	var output, returning string
+	if pk := tok.PK(); pk != nil && pk.Auto() {
+		switch {
+		case d.returningInto:
+			returning = fmt.Sprintf(" RETURNING %s INTO %s", d.ident(pk.Column), d.Placeholder(len(binds)+1))
+		case d.outputInserted && d.returning:
+			output = " OUTPUT INSERTED." + d.ident(pk.Column)
+		case d.returning:
+			returning = " RETURNING " + d.ident(pk.Column)
+		}
+	}
+
+	if len(cols) == 0 && !d.onDuplicateKey {
+		return fmt.Sprintf("INSERT INTO %s%s DEFAULT VALUES%s", d.ident(tok.Table), output, returning)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s)%s VALUES (%s)%s",
+		d.ident(tok.Table), strings.Join(cols, ", "), output, strings.Join(binds, ", "), returning)
+}
+
+// upsertSQL returns an INSERT of every column of tok that updates the
+// other columns when the primary key already exists.
+func (d dialect) upsertSQL(tok structToken) string {
+	pk := d.ident(tok.PK().Column)
+
+	var sets []string
+	for _, f := range tok.Fields {
+		if f.PK {
+			continue
+		}
+
+		col := d.ident(f.Column)
+		if d.onDuplicateKey {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", col, col))
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		}
+	}
+
+	switch {
+	case d.onDuplicateKey && len(sets) == 0:
+		return fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s = %s", d.insertSQL(tok), pk, pk)
+	case d.onDuplicateKey:
+		return fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s", d.insertSQL(tok), strings.Join(sets, ", "))
+	case len(sets) == 0:
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", d.insertSQL(tok), pk)
+	}
+
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", d.insertSQL(tok), pk, strings.Join(sets, ", "))
+}
@@ -0,0 +1,64 @@
+package main
+
+// driver describes the database API generated code calls. Its fields are
+// read by the templates.
+type driver struct {
+	// Exec, Query and QueryRow are the names of the query methods.
+	Exec, Query, QueryRow string
+
+	// Rows is the type plural scan functions take.
+	Rows string
+
+	// Row lists the types single-row scan functions accept.
+	Row string
+
+	// ErrNoRows is the error QueryRow's Scan returns when no row matches.
+	ErrNoRows string
+
+	// Conns lists the types implementing the generated DBTX interface.
+	Conns string
+}
+
+var drivers = map[string]driver{
+	"database/sql": {
+		Exec:      "ExecContext",
+		Query:     "QueryContext",
+		QueryRow:  "QueryRowContext",
+		Rows:      "*sql.Rows",
+		Row:       "*sql.Row and *sql.Rows",
+		ErrNoRows: "sql.ErrNoRows",
+		Conns:     "*sql.DB, *sql.Tx and *sql.Conn",
+	},
+	"pgx": {
+		Exec:      "Exec",
+		Query:     "Query",
+		QueryRow:  "QueryRow",
+		Rows:      "pgx.Rows",
+		Row:       "pgx.Row and pgx.Rows",
+		ErrNoRows: "pgx.ErrNoRows",
+		Conns:     "*pgx.Conn, *pgxpool.Pool and pgx.Tx",
+	},
+	"sqlx": {
+		Exec:      "ExecContext",
+		Query:     "QueryContext",
+		QueryRow:  "QueryRowxContext",
+		Rows:      "*sql.Rows",
+		Row:       "*sql.Row, *sql.Rows and *sqlx.Row",
+		ErrNoRows: "sql.ErrNoRows",
+		Conns:     "*sqlx.DB and *sqlx.Tx",
+	},
+	"gocql": {
+		Query:     "Query",
+		Rows:      "*gocql.Iter",
+		Row:       "*gocql.Query",
+		ErrNoRows: "gocql.ErrNotFound",
+		Conns:     "*gocql.Session",
+	},
+	// spanner generates row mappers and mutations rather than queries
+	"spanner": {
+		Rows:      "*spanner.RowIterator",
+		Row:       "*spanner.Row",
+		ErrNoRows: "spanner.ErrRowNotFound",
+		Conns:     "*spanner.Client",
+	},
+}
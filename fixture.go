@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// fixtureStmt returns the statements filling the field of struct s with a
+// value drawn from fixtureRand, or an empty string when fixtures leave
+// fields of its type zero.
+func fixtureStmt(f fieldToken) string {
+	if f.Sub != nil {
+		return ""
+	}
+
+	field := "s." + f.Name
+	switch f.BaseType() {
+	case "bool":
+		return fmt.Sprintf("%s = fixtureRand.Intn(2) == 1", field)
+	case "string":
+		if f.Base != "" {
+			// named string types need a conversion, constants don't
+			return fmt.Sprintf("%s = %s(fmt.Sprintf(\"%s %%d\", fixtureRand.Intn(1000000)))", field, f.QualType, f.Column)
+		}
+		return fmt.Sprintf("%s = fmt.Sprintf(\"%s %%d\", fixtureRand.Intn(1000000))", field, f.Column)
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return fmt.Sprintf("%s = %s(fixtureRand.Intn(100) + 1)", field, f.QualType)
+	case "float32", "float64":
+		return fmt.Sprintf("%s = %s(fixtureRand.Float64() * 1000)", field, f.QualType)
+	case "time.Time":
+		return fmt.Sprintf("%s = fixtureEpoch.Add(time.Duration(fixtureRand.Intn(365*24*3600)) * time.Second)", field)
+	case "time.Duration":
+		return fmt.Sprintf("%s = time.Duration(fixtureRand.Intn(3600)) * time.Second", field)
+	case "[]byte":
+		return fmt.Sprintf("%s = make([]byte, 16)\n\tfixtureRand.Read(%s)", field, field)
+	case "uuid.UUID":
+		return fmt.Sprintf("fixtureRand.Read(%s[:])", field)
+	}
+
+	return ""
+}
@@ -0,0 +1,753 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// outputFile describes a generated file.
+type outputFile struct {
+	Path     string   `json:"path"`
+	Structs  int      `json:"structs"`
+	Bytes    int      `json:"bytes"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// genFile generates code for toks, and methods for enums, and returns the
+// files it wrote.
+func genFile(opts *options, toks []structToken, enums []enumToken) ([]outputFile, error) {
+	if len(toks) < 1 {
+		return nil, errors.New("no structs found")
+	}
+
+	d := dialects[opts.Dialect]
+	d.quoteAll = opts.QuoteIdentifiers
+
+	drv, known := drivers[opts.Driver]
+	if !known {
+		drv = drivers["database/sql"]
+	}
+
+	// warnings by the part of the generated code they concern
+	warnings := make(map[string][]string)
+	warn := func(part, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		log.Print(msg)
+		warnings[part] = append(warnings[part], msg)
+	}
+
+	// every import the generated code might refer to, unused ones are
+	// removed after executing the template
+	importSet := map[string]bool{
+		"context":                            true,
+		"database/sql":                       true,
+		"encoding/base64":                    true,
+		"encoding/json":                      true,
+		"errors":                             true,
+		"fmt":                                true,
+		"iter":                               true,
+		"math/rand":                          true,
+		"reflect":                            true,
+		"sort":                               true,
+		"strconv":                            true,
+		"strings":                            true,
+		"time":                               true,
+		"github.com/jackc/pgx/v5":            true,
+		"github.com/jackc/pgx/v5/pgconn":     true,
+		"github.com/Masterminds/squirrel":    true,
+		"github.com/jmoiron/sqlx":            true,
+		"cloud.google.com/go/spanner":        true,
+		"github.com/gocql/gocql":             true,
+		"go.opentelemetry.io/otel":           true,
+		"go.opentelemetry.io/otel/attribute": true,
+		"go.opentelemetry.io/otel/codes":     true,
+		"go.opentelemetry.io/otel/trace":     true,
+	}
+	// both packages are named driver, so next to clickhouse-go's the
+	// Value methods of enums refer to database/sql/driver as sqldriver
+	sqlDriver := "driver"
+	if d.prepareBatch {
+		importSet["github.com/ClickHouse/clickhouse-go/v2/lib/driver"] = true
+	}
+	if len(enums) > 0 {
+		if d.prepareBatch {
+			sqlDriver = "sqldriver"
+			importSet["sqldriver database/sql/driver"] = true
+		} else {
+			importSet["database/sql/driver"] = true
+		}
+	}
+	helperSet := make(map[string]bool)
+	srcImports := make(map[string]bool)
+	for _, tok := range toks {
+		if tok.Selector != "" && tok.Selector != importName(tok.Import) {
+			// named after its package clause, which the path doesn't tell
+			importSet[tok.Selector+" "+tok.Import] = true
+		} else {
+			importSet[tok.Import] = true
+		}
+
+		for _, imp := range tok.Imports {
+			srcImports[imp] = true
+		}
+		for _, f := range tok.Fields {
+			for _, imp := range f.Strategy.Imports {
+				importSet[imp] = true
+			}
+			if f.Strategy.Helper != "" {
+				helperSet[f.Strategy.Helper] = true
+			}
+			if f.Sub != nil {
+				importSet["github.com/jackc/pgx/v5/pgtype"] = true
+			}
+		}
+
+		for _, fn := range []string{"get", "list", "exists", "queue", "upsert", "update", "delete", "prepare"} {
+			part := "read"
+			if fn == "upsert" || fn == "update" || fn == "delete" || fn == "prepare" {
+				part = "write"
+			}
+			if opts.Wants(fn) && tok.PK() == nil {
+				warn(part, "struct %s has no primary key, skipping %s helper", tok.Name, fn)
+			}
+		}
+		if opts.Wants("copy") && !canCopy(tok) {
+			warn("write", "struct %s has fields bound with SQL expressions, skipping copy helper", tok.Name)
+		}
+		if opts.ByName && opts.UnknownColumns == "extra" && tok.Extra == nil {
+			return nil, fmt.Errorf("struct %s has no field tagged extra to collect unknown columns in", tok.Name)
+		}
+		if opts.Maps && tok.PK() != nil && !tok.PK().comparable() {
+			warn("read", "primary key of struct %s can't be a map key, skipping map scan function", tok.Name)
+		}
+		if opts.Repo && tok.PK() == nil {
+			warn("write", "struct %s has no primary key, skipping repository", tok.Name)
+		}
+		if opts.Wants("search") && len(tok.FullText()) > 0 && d.fullText == "" {
+			warn("read", "dialect %s has no full-text search, skipping search helper of struct %s", opts.Dialect, tok.Name)
+		}
+	}
+
+	// imports of the source files only qualify field types; those named like
+	// another package the generated code imports are imported under an
+	// alias, which the field types of their structs are rewritten to use
+	imported := make(map[string]string) // path to the name it's imported as
+	taken := make(map[string]bool)
+	for imp := range importSet {
+		imported[importPath(imp)] = importName(imp)
+		taken[importName(imp)] = true
+	}
+	srcList := make([]string, 0, len(srcImports))
+	for imp := range srcImports {
+		srcList = append(srcList, imp)
+	}
+	sort.Strings(srcList)
+	aliases := make(map[string]string)
+	for _, imp := range srcList {
+		path, name := importPath(imp), importName(imp)
+		if taken[name] && imported[path] != name {
+			// the name is another package's, so the path is referred to
+			// by the name it's imported under already or by an alias
+			if existing, isImported := imported[path]; isImported {
+				name = existing
+			} else {
+				name = importAlias(path, importName(path), taken)
+			}
+			aliases[imp] = name
+		}
+		if taken[name] {
+			continue
+		}
+
+		if name == importName(path) {
+			importSet[path] = true
+		} else {
+			importSet[name+" "+path] = true
+		}
+		if _, isImported := imported[path]; !isImported {
+			imported[path] = name
+		}
+		taken[name] = true
+	}
+	if len(aliases) > 0 {
+		toks = requalify(toks, aliases)
+	}
+
+	var importList []string
+	for targetImport := range importSet {
+		if targetImport == "" {
+			continue
+		}
+		importList = append(importList, targetImport)
+	}
+	sort.Slice(importList, func(i, j int) bool { return importPath(importList[i]) < importPath(importList[j]) })
+
+	var helperList []string
+	for helper := range helperSet {
+		helperList = append(helperList, helper)
+	}
+	sort.Strings(helperList)
+
+	st, err := newStamp(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data := struct {
+		Stamp       stamp
+		PackageName string
+		Import      []string
+		Helpers     []string
+		Tokens      []structToken
+		Enums       []enumToken
+		Opts        *options
+	}{
+		Stamp:       st,
+		PackageName: opts.Package,
+		Import:      importList,
+		Helpers:     helperList,
+		Tokens:      toks,
+		Enums:       enums,
+		Opts:        opts,
+	}
+
+	// part is the part of the generated code being rendered when the
+	// layout splits it into several files
+	var part string
+
+	fnMap := template.FuncMap{
+		"comparable": comparable,
+		"fixture":    fixtureStmt,
+		"timeout": func(tok structToken, class string) string {
+			timeout, exists := tok.Timeouts[class]
+			if !exists {
+				timeout = opts.Timeouts[class]
+			}
+			if timeout == "" {
+				return ""
+			}
+
+			d, _ := time.ParseDuration(timeout) // checked when parsed
+			return durationExpr(d)
+		},
+		"versioned": func() bool {
+			for _, tok := range toks {
+				if tok.VersionField() != nil {
+					return true
+				}
+			}
+			return false
+		},
+		"part": func(p string) bool {
+			return opts.Layout != "split" || p == part
+		},
+		"title":   strings.Title,
+		"name":    opts.name,
+		"opts":    func() *options { return opts },
+		"driver":  func() driver { return drv },
+		"pgx":     func() bool { return opts.Driver == "pgx" },
+		"sqlx":    func() bool { return opts.Driver == "sqlx" },
+		"spanner": func() bool { return opts.Driver == "spanner" },
+		"gocql":   func() bool { return opts.Driver == "gocql" },
+		"cqlColumns": func(tok structToken) string {
+			cols := make([]string, len(tok.Fields))
+			for i, f := range tok.Fields {
+				cols[i] = f.Column
+			}
+			return strings.Join(cols, ", ")
+		},
+		"cqlMarks": func(tok structToken) string {
+			return strings.TrimSuffix(strings.Repeat("?, ", len(tok.Fields)), ", ")
+		},
+		"quote": strconv.Quote,
+		"ph":    d.Placeholder,
+		"importSpec": func(imp string) string {
+			if i := strings.IndexByte(imp, ' '); i > 0 {
+				return imp[:i] + " " + strconv.Quote(imp[i+1:])
+			}
+			return strconv.Quote(imp)
+		},
+		"selectFrom": func(tok structToken) string {
+			return fmt.Sprintf("SELECT %s FROM %s", d.selectList(tok), d.ident(tok.Table))
+		},
+		"columnList": func(tok structToken) string {
+			exprs := make([]string, len(tok.Fields))
+			for i, f := range tok.Fields {
+				exprs[i] = strconv.Quote(f.SelectExpr(d))
+			}
+			return strings.Join(exprs, ", ")
+		},
+		"ident":    d.ident,
+		"equals":   d.equals,
+		"exists":   d.exists,
+		"search":   d.searchSQL,
+		"paginate": d.paginate,
+		"searchArgs": func(tok structToken) string {
+			return strings.Join(d.searchArgs(tok), ", ")
+		},
+		"canSearch": func(tok structToken) bool {
+			return d.fullText != "" && len(tok.FullText()) > 0
+		},
+		"afterScan": func(tok structToken, ctx, fail string) string {
+			if !tok.Hooks["AfterScan"] {
+				return ""
+			}
+			return fmt.Sprintf("\nif err := s.AfterScan(%s); err != nil {\nreturn %s\n}", ctx, fail)
+		},
+		"span": func(tok structToken, op, rows string) string {
+			if !opts.Otel {
+				return ""
+			}
+			if rows == "" {
+				rows = "-1"
+			}
+			return fmt.Sprintf("\nctx, span := %s.Start(ctx, %q, trace.WithAttributes(attribute.String(\"db.sql.table\", %q)))\ndefer func() {\nendSpan(span, err, %s)\n}()\n",
+				opts.name("Tracer"), tok.Name+"."+op, tok.Table, rows)
+		},
+		"namedResults": func() bool { return opts.Audit || opts.Otel },
+		"validate": func(tok structToken, fail string) string {
+			if !opts.Validate || !tok.Hooks["Validate"] {
+				return ""
+			}
+			return fmt.Sprintf("\nif err := x.Validate(); err != nil {\nreturn %s\n}", fail)
+		},
+		"audit": func(tok structToken, op, pk string) string {
+			if !opts.Audit {
+				return ""
+			}
+			if pk == "x" {
+				pk = "nil"
+				if tok.PK() != nil {
+					pk = "x." + tok.PK().Name
+				}
+			}
+			return fmt.Sprintf("\ndefer func() {\nif err == nil && %s != nil {\n%s(ctx, %q, %q, %s)\n}\n}()\n",
+				opts.name("AuditFunc"), opts.name("AuditFunc"), tok.Table, op, pk)
+		},
+		"rowsCtx": func() string {
+			if opts.CheckRows > 0 {
+				return "ctx"
+			}
+			return "context.Background()"
+		},
+		"canCopy": canCopy,
+		"changed": changed,
+		"identifier": func(table string) string {
+			parts := strings.Split(table, ".")
+			for i := range parts {
+				parts[i] = strconv.Quote(parts[i])
+			}
+			return fmt.Sprintf("pgx.Identifier{%s}", strings.Join(parts, ", "))
+		},
+		"lower":     lowerInitial,
+		"updateSQL": d.updateSQL,
+		"numbered":  func() bool { return d.numbered },
+		"placeholderFormat": func() string {
+			// squirrel's name of the placeholders, which default to ?
+			return map[string]string{"$": "Dollar", "@p": "AtP", ":": "Colon"}[d.bindVar]
+		},
+		"phExpr": d.placeholderExpr,
+		"setFormat": func(f fieldToken) string {
+			return d.ident(f.Column) + " = " + f.BindExpr(dialect{bindVar: "%s"}, 0)
+		},
+		"live": func(tok structToken, prefix string) string {
+			if deletedAt := tok.DeletedAt(); deletedAt != nil {
+				return prefix + d.ident(deletedAt.Column) + " IS NULL"
+			}
+			return ""
+		},
+		"deleteSQL": func(tok structToken) string {
+			if deletedAt := tok.DeletedAt(); deletedAt != nil {
+				return fmt.Sprintf("UPDATE %s SET %s = CURRENT_TIMESTAMP WHERE %s AND %s IS NULL",
+					d.ident(tok.Table), d.ident(deletedAt.Column), d.equals(*tok.PK(), 1), d.ident(deletedAt.Column))
+			}
+			return fmt.Sprintf("DELETE FROM %s WHERE %s", d.ident(tok.Table), d.equals(*tok.PK(), 1))
+		},
+		"insertSQL": d.insertSQL,
+		"createSQL": d.createSQL,
+		"returning": func(tok structToken) bool {
+			pk := tok.PK()
+			return d.returning && pk != nil && pk.Auto()
+		},
+		"returningInto": func(tok structToken) bool {
+			pk := tok.PK()
+			return d.returningInto && pk != nil && pk.Auto()
+		},
+		"lastInsertID": func(tok structToken) bool {
+			pk := tok.PK()
+			return d.lastInsertID && pk != nil && pk.Auto() && contains(integerTypes, pk.BaseType())
+		},
+		"upsertSQL": d.upsertSQL,
+		"namedCreateSQL": func(tok structToken) string {
+			return d.named(dialect.createSQL, tok, tok.createFields())
+		},
+		"namedUpdateSQL": func(tok structToken) string {
+			return d.named(dialect.updateSQL, tok, tok.updateFields())
+		},
+		"namedUpsertSQL": func(tok structToken) string {
+			return d.named(dialect.upsertSQL, tok, tok.Fields)
+		},
+		"sqlDriver":    func() string { return sqlDriver },
+		"batchRow":     d.batchRow,
+		"createFields": structToken.createFields,
+		"prepareBatch": func() bool { return d.prepareBatch },
+		"insertBatch": func(tok structToken) string {
+			return fmt.Sprintf("INSERT INTO %s (%s)", d.ident(tok.Table), strings.Join(d.createColumns(tok), ", "))
+		},
+		"rowsPerInsert": func(tok structToken) int {
+			return d.rowsPerInsert(tok, opts.BatchSize, opts.MaxParams)
+		},
+		"insertInto": func(tok structToken) string {
+			return fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.ident(tok.Table), strings.Join(d.createColumns(tok), ", "))
+		},
+	}
+	scansTmpl := template.New("scans").Funcs(fnMap)
+	for _, text := range []string{scansText, rowScannerText, dbtxText, notFoundText, tooManyRowsText, auditText, otelText, queryLoggerText, conflictText, noRowsAffectedText, getText, findText, searchText, squirrelText, listText, countText, insertText, upsertText, updateText, batchText, copyText, queueText, prepareText, repoText, fixtureText, namedArgsText, mapFuncsText, spannerText, gocqlText, helpersText} {
+		if _, err := scansTmpl.Parse(text); err != nil {
+			return nil, err
+		}
+	}
+
+	render := func() ([]byte, error) {
+		data.Import = importList
+
+		var buf bytes.Buffer
+		if err := scansTmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+
+		// execute again with only the imports the generated code uses
+		used, err := usedPackages(buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("generated invalid code: %s", err)
+		}
+
+		data.Import = nil
+		for _, imp := range importList {
+			if used[importName(imp)] {
+				data.Import = append(data.Import, imp)
+			}
+		}
+
+		buf.Reset()
+		if err := scansTmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("generated invalid code: %s", err)
+		}
+
+		return src, nil
+	}
+
+	parts := []string{"common", "read", "write"}
+	if opts.Layout != "split" {
+		src, err := render()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeOutput(opts.Output, src); err != nil {
+			return nil, err
+		}
+
+		out := outputFile{Path: opts.Output, Structs: len(toks), Bytes: len(src)}
+		for _, part := range parts {
+			out.Warnings = append(out.Warnings, warnings[part]...)
+		}
+		return []outputFile{out}, nil
+	}
+
+	var files []outputFile
+	for _, part = range parts {
+		src, err := render()
+		if err != nil {
+			return nil, err
+		}
+
+		astf, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		if err != nil {
+			return nil, err
+		}
+		if isEmpty(astf) {
+			continue
+		}
+
+		path := partFile(opts.Output, part)
+		if err := writeOutput(path, src); err != nil {
+			return nil, err
+		}
+
+		files = append(files, outputFile{
+			Path:     path,
+			Structs:  structsIn(astf, toks),
+			Bytes:    len(src),
+			Warnings: warnings[part],
+		})
+	}
+
+	return files, nil
+}
+
+// writeOutput writes generated code src to the file at path, or to stdout
+// when path is -.
+func writeOutput(path string, src []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+
+	return ioutil.WriteFile(path, src, 0644)
+}
+
+// partFile returns the name of the file a part of the generated code goes
+// to when splitting it, e.g. scans_read.go. Common code keeps the name of
+// output.
+func partFile(output, part string) string {
+	if part == "common" {
+		return output
+	}
+
+	return strings.TrimSuffix(output, ".go") + "_" + part + ".go"
+}
+
+// isEmpty reports whether astf declares nothing but imports.
+func isEmpty(astf *ast.File) bool {
+	for _, decl := range astf.Decls {
+		if gen, isGen := decl.(*ast.GenDecl); !isGen || gen.Tok != token.IMPORT {
+			return false
+		}
+	}
+
+	return true
+}
+
+// structsIn returns the number of structs of toks astf refers to.
+func structsIn(astf *ast.File, toks []structToken) int {
+	referred := make(map[string]bool)
+	ast.Inspect(astf, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			if pkg, isIdent := x.X.(*ast.Ident); isIdent {
+				referred[pkg.Name+"."+x.Sel.Name] = true
+			}
+		case *ast.Ident:
+			referred[x.Name] = true
+		}
+		return true
+	})
+
+	var n int
+	for _, tok := range toks {
+		if referred[tok.TypeName()] {
+			n++
+		}
+	}
+
+	return n
+}
+
+// durationExpr returns a Go expression of d, e.g. 2 * time.Second.
+func durationExpr(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "Hour"},
+		{time.Minute, "Minute"},
+		{time.Second, "Second"},
+		{time.Millisecond, "Millisecond"},
+		{time.Microsecond, "Microsecond"},
+	}
+	for _, unit := range units {
+		if d%unit.d == 0 {
+			return fmt.Sprintf("%d * time.%s", d/unit.d, unit.name)
+		}
+	}
+
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
+
+// changed returns the condition under which field f of old and new differs.
+// Pointers of separately scanned rows never are equal, so what they point to
+// is compared instead.
+func changed(f fieldToken) string {
+	if !strings.HasPrefix(f.Type, "*") {
+		switch {
+		case f.Type == "time.Time":
+			return fmt.Sprintf("!old.%s.Equal(new.%s)", f.Name, f.Name)
+		case f.comparable() && !isPgtype(f.Type):
+			return fmt.Sprintf("old.%s != new.%s", f.Name, f.Name)
+		}
+		return fmt.Sprintf("!reflect.DeepEqual(old.%s, new.%s)", f.Name, f.Name)
+	}
+
+	elem := fieldToken{Type: f.Type[1:]}
+	if ptr, isPtr := f.GoType.(*types.Pointer); isPtr {
+		elem.GoType = ptr.Elem()
+	}
+	nils := fmt.Sprintf("(old.%s == nil) != (new.%s == nil)", f.Name, f.Name)
+	switch {
+	case elem.Type == "time.Time":
+		return fmt.Sprintf("%s || old.%s != nil && !old.%s.Equal(*new.%s)", nils, f.Name, f.Name, f.Name)
+	case elem.comparable() && !isPgtype(elem.Type):
+		return fmt.Sprintf("%s || old.%s != nil && *old.%s != *new.%s", nils, f.Name, f.Name, f.Name)
+	}
+	// reflect.DeepEqual compares what pointers point to
+	return fmt.Sprintf("!reflect.DeepEqual(old.%s, new.%s)", f.Name, f.Name)
+}
+
+// canCopy reports whether rows of tok can be copied, with no field needing
+// an SQL expression around its placeholder.
+func canCopy(tok structToken) bool {
+	for _, f := range tok.Fields {
+		if f.Strategy.Bind != "" || f.Sub != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// comparable reports whether values of goType can be compared, as far as
+// its name tells.
+func comparable(goType string) bool {
+	return !strings.HasPrefix(goType, "[]") && !strings.HasPrefix(goType, "map[") && goType != "pgtype.Hstore"
+}
+
+// isPgtype reports whether goType is, or points to, a type from pgx's
+// pgtype package.
+func isPgtype(goType string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(goType, "*"), "pgtype.")
+}
+
+// usedPackages returns the names of the packages src refers to.
+func usedPackages(src []byte) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	astf, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(astf, func(n ast.Node) bool {
+		sel, isSelector := n.(*ast.SelectorExpr)
+		if !isSelector {
+			return true
+		}
+
+		// package names are the only identifiers the parser can't resolve
+		if ident, isIdent := sel.X.(*ast.Ident); isIdent && ident.Obj == nil {
+			used[ident.Name] = true
+		}
+		return true
+	})
+
+	return used, nil
+}
+
+// importPath returns the path of an import, which renamed imports follow
+// their name with.
+func importPath(imp string) string {
+	return imp[strings.IndexByte(imp, ' ')+1:]
+}
+
+// importAlias returns a name for the import path of a package called name
+// that isn't taken, prefixing name with the elements before it, e.g.
+// database/sql/driver is sqldriver.
+func importAlias(path, name string, taken map[string]bool) string {
+	alias := name
+	elems := strings.Split(path, "/")
+	for i := len(elems) - 2; i >= 0 && taken[alias]; i-- {
+		alias = strings.Map(func(r rune) rune {
+			if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return -1
+			}
+			return unicode.ToLower(r)
+		}, elems[i]) + alias
+	}
+
+	base := alias
+	for n := 2; taken[alias]; n++ {
+		alias = base + strconv.Itoa(n)
+	}
+
+	return alias
+}
+
+// requalify returns toks with the field types of structs whose source files
+// import a package renamed in aliases, keyed by path, qualified by the alias.
+func requalify(toks []structToken, aliases map[string]string) []structToken {
+	requalified := make([]structToken, len(toks))
+	for i, tok := range toks {
+		fields := make([]fieldToken, len(tok.Fields))
+		copy(fields, tok.Fields)
+		for _, imp := range tok.Imports {
+			alias, renamed := aliases[imp]
+			if !renamed {
+				continue
+			}
+
+			qualifier := regexp.MustCompile(`\b` + importName(imp) + `\.`)
+			for j := range fields {
+				fields[j].QualType = qualifier.ReplaceAllString(fields[j].QualType, alias+".")
+			}
+		}
+
+		tok.Fields = fields
+		requalified[i] = tok
+	}
+
+	return requalified
+}
+
+// importName guesses the name of an imported package from its path, e.g.
+// github.com/jackc/pgx/v5 is pgx and github.com/Rhymond/go-money is money.
+// Renamed imports, the name and path separated by a space, are their name.
+func importName(path string) string {
+	if i := strings.IndexByte(path, ' '); i > 0 {
+		return path[:i]
+	}
+
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+
+	if i := strings.Index(name, ".v"); i > 0 {
+		// gopkg.in/yaml.v2
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+
+	return strings.Replace(name, "-", "", -1)
+}
+
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFile is the name of the config file written by scaneo init.
+const configFile = "scaneo.json"
+
+// generateFile is the name of the file holding go:generate comments
+// written by scaneo init.
+const generateFile = "scaneo_generate.go"
+
+// target is a package with structs that look like they map to tables.
+type target struct {
+	Dir     string
+	Package string
+	Files   []string
+	Structs []string
+}
+
+// initModule runs the init command for the module in dir, asking
+// questions on out and reading answers from in.
+func initModule(dir string, in io.Reader, out io.Writer) error {
+	module, err := modulePath(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+
+	targets, err := findTargets(dir)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no structs with db tags found")
+	}
+
+	fmt.Fprintf(out, "Found structs with db tags in module %s:\n", module)
+	for i, t := range targets {
+		fmt.Fprintf(out, "  %d) %s: %s\n", i+1, t.Dir, strings.Join(t.Structs, ", "))
+	}
+
+	answers := bufio.NewScanner(in)
+	ask := func(question, def string) string {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		if !answers.Scan() {
+			return def
+		}
+		if answer := strings.TrimSpace(answers.Text()); answer != "" {
+			return answer
+		}
+		return def
+	}
+
+	chosen, err := chooseTargets(targets, ask("Generate code for which packages, by number", "all"))
+	if err != nil {
+		return err
+	}
+
+	var opts options
+	if opts.Dialect = ask("Dialect, postgres, mysql, sqlite, mssql, oracle, clickhouse or none", "none"); opts.Dialect == "none" {
+		opts.Dialect = ""
+	}
+	if opts.Dialect != "" {
+		if driver := ask("Driver, database/sql, pgx or sqlx", "database/sql"); driver != "database/sql" {
+			opts.Driver = driver
+		}
+		opts.Funcs = ask("Query helpers, comma-delimited", "get,list,upsert")
+		opts.Repo = strings.HasPrefix(strings.ToLower(ask("Generate repositories, y or n", "n")), "y")
+	}
+
+	// the config only holds the answers, flags default the other options
+	withDefaults := opts
+	withDefaults.BatchSize, withDefaults.Layout, withDefaults.UnknownColumns = 500, "single", "error"
+	if withDefaults.Driver == "" {
+		withDefaults.Driver = "database/sql"
+	}
+	if err := withDefaults.check(); err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(dir, configFile)
+	if _, err := os.Stat(configPath); err == nil {
+		if !strings.HasPrefix(ask(configFile+" exists, overwrite it, y or n", "n"), "y") {
+			return errors.New("not overwriting " + configPath)
+		}
+	}
+
+	js, err := json.MarshalIndent(opts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(configPath, append(js, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s\n", configPath)
+
+	for _, t := range chosen {
+		rel, err := filepath.Rel(filepath.Join(dir, t.Dir), configPath)
+		if err != nil {
+			return err
+		}
+
+		args := []string{"scaneo", "-c", filepath.ToSlash(rel), "-p", t.Package}
+		for _, f := range t.Files {
+			args = append(args, "="+f)
+		}
+
+		src := fmt.Sprintf("package %s\n\n//go:generate %s\n", t.Package, strings.Join(args, " "))
+		path := filepath.Join(dir, t.Dir, generateFile)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote %s\n", path)
+	}
+
+	fmt.Fprintln(out, "Run go generate ./... to generate code.")
+	return nil
+}
+
+// modulePath returns the module path declared in the go.mod file at path.
+func modulePath(path string) (string, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("scaneo init runs in a module root: %s", err)
+	}
+
+	for _, line := range strings.Split(string(src), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s declares no module", path)
+}
+
+// findTargets returns the packages under dir declaring structs with db
+// tags, sorted by directory.
+func findTargets(dir string) ([]target, error) {
+	byDir := make(map[string]*target)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := fi.Name()
+		if fi.IsDir() {
+			if path != dir && (name[0] == '.' || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") || name == generateFile {
+			return nil
+		}
+
+		astf, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+
+		structs := taggedStructs(astf)
+		if len(structs) == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		t, found := byDir[rel]
+		if !found {
+			t = &target{Dir: rel, Package: astf.Name.Name}
+			byDir[rel] = t
+		}
+		t.Files = append(t.Files, name)
+		t.Structs = append(t.Structs, structs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]target, 0, len(byDir))
+	for _, t := range byDir {
+		targets = append(targets, *t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Dir < targets[j].Dir })
+
+	return targets, nil
+}
+
+// taggedStructs returns the names of the structs in astf with a field
+// tagged db.
+func taggedStructs(astf *ast.File) []string {
+	var names []string
+	ast.Inspect(astf, func(n ast.Node) bool {
+		typeSpec, isTypeSpec := n.(*ast.TypeSpec)
+		if !isTypeSpec {
+			return true
+		}
+
+		structType, isStruct := typeSpec.Type.(*ast.StructType)
+		if !isStruct || typeSpec.TypeParams != nil {
+			return false
+		}
+
+		for _, field := range structType.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			if _, tagged := reflect.StructTag(tag).Lookup("db"); tagged {
+				names = append(names, typeSpec.Name.Name)
+				break
+			}
+		}
+		return false
+	})
+
+	return names
+}
+
+// chooseTargets returns the targets picked by answer, all or a
+// comma-delimited list of 1-based numbers.
+func chooseTargets(targets []target, answer string) ([]target, error) {
+	if answer == "all" {
+		return targets, nil
+	}
+
+	var chosen []target
+	for _, num := range strings.Split(answer, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(num))
+		if err != nil || i < 1 || i > len(targets) {
+			return nil, fmt.Errorf("no package numbered %q", num)
+		}
+		chosen = append(chosen, targets[i-1])
+	}
+
+	return chosen, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stamp describes how a generated file was produced. It's written to the
+// file as //scaneo:key value comments.
+type stamp struct {
+	Version     string
+	Templates   string
+	Fingerprint string
+	Options     string // options as compact JSON
+}
+
+func newStamp(opts *options) (stamp, error) {
+	// the output is recorded relative to its package directory, where
+	// go:generate runs, so stamps don't depend on the checkout
+	recorded := *opts
+	if recorded.Output != "-" {
+		recorded.Output = filepath.Base(recorded.Output)
+	}
+
+	js, err := json.Marshal(&recorded)
+	if err != nil {
+		return stamp{}, err
+	}
+
+	return stamp{
+		Version:     version,
+		Templates:   opts.Driver,
+		Fingerprint: fingerprint(js),
+		Options:     string(js),
+	}, nil
+}
+
+// fingerprint returns a short hash of the options JSON js.
+func fingerprint(js []byte) string {
+	sum := sha256.Sum256(js)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readStamp reads the stamp of the generated file at path.
+func readStamp(path string) (stamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return stamp{}, err
+	}
+	defer f.Close()
+
+	var st stamp
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20) // options can be longer than the default line limit
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+
+		fields := strings.SplitN(strings.TrimPrefix(line, "//scaneo:"), " ", 2)
+		if len(fields) != 2 || !strings.HasPrefix(line, "//scaneo:") {
+			continue
+		}
+
+		switch fields[0] {
+		case "version":
+			st.Version = fields[1]
+		case "templates":
+			st.Templates = fields[1]
+		case "fingerprint":
+			st.Fingerprint = fields[1]
+		case "options":
+			st.Options = fields[1]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return stamp{}, err
+	}
+
+	if st.Version == "" {
+		return stamp{}, fmt.Errorf("%s has no scaneo stamp", path)
+	}
+
+	return st, nil
+}
+
+// inspect runs the inspect command, reporting how the generated files
+// named by args were produced.
+func inspect(args []string) error {
+	if len(args) == 0 {
+		return errors.New("inspect needs a generated file")
+	}
+
+	for _, path := range args {
+		st, err := readStamp(path)
+		if err != nil {
+			return err
+		}
+
+		var opts bytes.Buffer
+		if err := json.Indent(&opts, []byte(st.Options), "", "  "); err != nil {
+			return fmt.Errorf("%s: invalid options: %s", path, err)
+		}
+
+		fmt.Printf("%s was generated by scaneo %s from the %s templates with options\n%s\n",
+			path, st.Version, st.Templates, opts.String())
+		if fingerprint([]byte(st.Options)) != st.Fingerprint {
+			fmt.Printf("%s: options don't match fingerprint %s, the stamp was edited\n", path, st.Fingerprint)
+		}
+	}
+
+	return nil
+}
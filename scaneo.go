@@ -1,30 +1,50 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/importer"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
-	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
+	version = "1.2.0"
+
 	usageText = `SCANEO
     Generate Go code to convert database rows into arbitrary structs.
 
 USAGE
-    scaneo [options] <golang_import_path=golang_source_package_or_file>...
+    scaneo [options] [<golang_import_path>=]<golang_source_package_or_file>...
+    scaneo inspect <generated_file>
+    scaneo init
 
 OPTIONS
     -o, -output
-        Set the name of the generated file. Default is scans.go.
+        Set the name of the generated file, or - to write the generated
+        code to stdout, e.g. to pipe it through goimports. Default is
+        scans.go.
 
     -p, -package
         Set the package name for the generated file. Default is current
@@ -35,7 +55,209 @@ OPTIONS
 
     -w, -whitelist
         Only include structs specified in case-sensitive, comma-delimited
-        string.
+        string. Entries may be glob patterns, e.g. "*Row". Without it,
+        structs with a //scaneo:generate comment are the ones included,
+        if any has one. Fails when an entry matches no struct.
+
+    -w-regex
+        Only include structs whose name matches this regular expression,
+        e.g. "^DB". Combines with -w, a struct matching either is
+        included.
+
+    -x, -exclude
+        Leave out structs specified in case-sensitive, comma-delimited
+        string, which may hold glob patterns too. Takes precedence over
+        -w and //scaneo:generate comments.
+
+    -tags
+        Set the comma-delimited build tags deciding which files of source
+        directories are parsed, as go build -tags does, e.g. postgres.
+        Files guarded by other constraints, like //go:build mysql, are
+        left out.
+
+    -qualify-names
+        Prefix the generated names of structs sharing a name with a
+        struct of another package with their package name, e.g.
+        ScanModelsPost, rather than failing.
+
+    -continue-on-error
+        Log and skip files and directories that can't be read while
+        walking source directories, rather than failing.
+
+    -skip-dirs
+        Skip subdirectories with these comma-delimited names while walking
+        source directories, or none to walk them all. Default is
+        vendor,testdata,.git.
+
+    -follow-symlinks
+        Walk symlinked subdirectories of source directories, which are
+        skipped otherwise. Directories are walked once, however many links
+        lead to them.
+
+    -exported-only
+        Skip unexported struct fields, which code generated in another
+        package can't set anyway.
+
+    -d, -dialect
+        Set the SQL dialect of generated queries: postgres, mysql,
+        sqlite, mssql, oracle or clickhouse, which decides their
+        placeholders, $1, ?, @p1 or :1.
+        Required by query helpers. A comma-delimited list of dialects
+        generates a file per dialect, e.g. scans_postgres.go, guarded by
+        a build tag named after it.
+
+    -schema
+        Qualify table names with this schema, e.g. analytics.events,
+        unless a //scaneo:table comment names a schema already.
+
+    -driver
+        Set the database API generated code calls: database/sql; pgx
+        for pgx v5's native API, taking pgx.Rows and a DBTX implemented
+        by *pgx.Conn, *pgxpool.Pool and pgx.Tx; sqlx, taking a DBTX
+        implemented by *sqlx.DB and *sqlx.Tx and writing rows with :named
+        queries; spanner, generating Cloud Spanner row mappers and
+        mutations instead of queries; or gocql, generating Cassandra scan
+        and insert functions. Default is database/sql.
+
+    -f, -funcs
+        Generate query helpers listed in comma-delimited string, in
+        addition to scan functions. Available helpers are select, get,
+        find, search, list, count, exists, insert, upsert, update, delete,
+        batch, copy, queue and prepare.
+
+    -batch-size
+        Set the maximum number of rows batch helpers insert per
+        statement. Default is 500.
+
+    -max-params
+        Set the maximum number of parameters per statement, which caps the
+        rows of batch inserts below -batch-size for wide structs. Default
+        is the dialect's limit: 65535 on postgres and mysql, 32766 on
+        sqlite and 2100 on mssql.
+
+    -max-rows
+        Fail plural scan functions with a TooManyRowsError once a query
+        returns more than this many rows. Default is 0, no limit.
+
+    -check-rows
+        Generate context-aware plural scan functions, used by query
+        helpers, that stop with the context error when the context is
+        done. The context is checked every this many rows. Default is 0,
+        never.
+
+    -repo
+        Generate a repository type per struct with a primary key, with
+        Get, List, Insert, Update and Delete methods.
+
+    -retry-tx
+        Retry transactions of WithPostTx-style functions up to this many
+        times when they fail with a serialization error, SQLSTATE 40001,
+        as CockroachDB requires clients to. Needs -repo. Default is 0,
+        never.
+
+    -strict
+        Fail update and delete helpers, repositories and prepared
+        statements with ErrNoRowsAffected when they match no row.
+
+    -validate
+        Call the Validate() error method of structs declaring one before
+        inserting or updating them, failing with its error.
+
+    -audit
+        Call the AuditFunc variable, when set, after insert, upsert,
+        update and delete helpers, repositories and prepared statements
+        write a row, with the table, operation and primary key.
+
+    -otel
+        Wrap query helpers, prepared statements and repositories in
+        OpenTelemetry spans named after the struct and operation, e.g.
+        Post.get, recording errors and the rows read or affected.
+
+    -log-queries
+        Call the QueryLogger variable, when set, after query helpers and
+        repositories run a query, with the query, its arguments, how long
+        it took and its error.
+
+    -layout
+        Set how generated code is laid out: single, one file, or split.
+        Split writes shared declarations to the output file, scan
+        functions and read helpers to a _read.go file, and write helpers
+        and repositories to a _write.go file. Default is single.
+
+    -by-name
+        Generate plural scan functions that match columns to fields by
+        name rather than position, e.g. ScanPostsByName.
+
+    -unknown-columns
+        Set what name-based scan functions do with columns no field
+        matches: error, ignore, or extra to collect them in the field
+        tagged extra. Default is error.
+
+    -quote-identifiers
+        Quote every table and column name in generated queries, e.g.
+        "post"."title" on postgres. Default is to quote only reserved
+        words, e.g. "user".
+
+    -loose-types
+        Scan sqlite booleans and times, which SQLite stores as integers
+        or text, through converters accepting any of their stored forms
+        rather than failing at runtime. Needs the sqlite dialect.
+
+    -strict-fields
+        Fail on fields of types scaneo can't scan, e.g. chan, func or
+        interface types, or maps other than postgres hstore columns,
+        rather than skipping them with a warning.
+
+    -maps
+        Generate scan functions returning a map keyed by primary key, e.g.
+        ScanPostsMap.
+
+    -stream
+        Generate functions handing rows to a channel or callback one at a
+        time instead of collecting them, e.g. StreamPosts and ForEachPost.
+
+    -iter
+        Generate functions returning an iterator over rows, e.g.
+        IterPosts. The generated code needs Go 1.23 or later.
+
+    -row-to
+        Generate pgx.RowToFunc functions scanning a row for
+        pgx.CollectRows and pgx.CollectOneRow, e.g. RowToPost. Always
+        generated with -driver pgx.
+
+    -fixtures
+        Generate functions returning structs filled with fixture data,
+        e.g. NewPostFixture.
+
+    -seed
+        Set the seed fixture data is generated from. Default is 1.
+
+    -named-args
+        Generate functions returning the fields of a struct as named query
+        arguments keyed by column, e.g. PostNamedArgs for sql.Named
+        arguments and PostArgMap for sqlx-style maps.
+
+    -map-funcs
+        Generate functions converting structs to and from maps of field
+        values keyed by column, e.g. PostToMap and PostFromMap.
+
+    -enums
+        Generate Scan and Value methods for string types with declared
+        constants, accepting only those values. Needs the generated file
+        in the package declaring the types.
+
+    -squirrel
+        Generate functions returning github.com/Masterminds/squirrel
+        select builders of the columns scan functions expect, e.g.
+        PostSelectBuilder.
+
+    -summary
+        Print a summary of the generated files, with their struct counts,
+        sizes and warnings, as text or json.
+
+    -c, -config
+        Read options and type mapping tables from a JSON file. Options
+        given on the command line take precedence.
 
     -v, -version
         Print version and exit.
@@ -58,10 +280,50 @@ EXAMPLES
     Generate scans.go with only struct Post and struct user.
         scaneo -w "Post,user" tables.go
 
+    Generate scans.go with only structs whose name ends in Row.
+        scaneo -w "*Row" tables.go
+
+    Generate scans.go with every struct but Internal and Config.
+        scaneo -x "Internal,Config" tables.go
+
+    Generate scan functions of structs read from stdin, to stdout.
+        cat tables.go | scaneo -
+
+    Generate scan functions and pipe them through goimports.
+        scaneo -o - tables.go | goimports > scans.go
+
+    Print the options scans.go was generated with.
+        scaneo inspect scans.go
+
+    Write a config file and go:generate comments for the current module,
+    answering questions about the code to generate.
+        scaneo init
+
 NOTES
     Struct field names don't have to match database column names at all.
     However, the order of the types must match.
 
+    An argument of - reads a source file of the generated package from
+    stdin, and has the generated code written to stdout unless -o is
+    given.
+
+    Arguments that aren't source paths are import paths of packages, e.g.
+    github.com/acme/app/models, found by the go tool in modules, vendor
+    directories or GOPATH. Suffixed with a version, e.g.
+    github.com/acme/contracts@v1.4.0, they're parsed from the module
+    cache, downloading the module if needed.
+
+    The import path of sources without one is inferred from the enclosing
+    go.mod, unless they're in the directory of the generated file. It can
+    be given explicitly too, e.g. example.com/models=models, or left empty
+    for sources of the generated package, e.g. =models.go. Sources in the
+    directory of the generated file are in its package whatever their
+    import path, so their types aren't qualified. Import paths can't
+    contain =, so the first = of an argument ends the import path and any
+    later one belongs to the source path, e.g.
+    example.com/models=dir=v2/models.go. A source path containing = in the
+    generated package needs a leading =, e.g. =dir=v2/models.go.
+
     Integrate this with go generate by adding this line to the top of your
     tables.go file.
         //go:generate scaneo $GOFILE
@@ -69,172 +331,1891 @@ NOTES
 )
 
 type fieldToken struct {
-	Name string
-	Type string
+	Name     string
+	Type     string
+	QualType string // Type qualified for use outside the source package
+	Column   string
+	SQLType  string
+	PK       bool
+	Opts     map[string]string // options from the db struct tag
+	Strategy strategy
+
+	// Sub holds the fields of a composite type column.
+	Sub []fieldToken
+
+	// GoType is the type-checked type of the field, nil when it doesn't
+	// resolve.
+	GoType types.Type
+
+	// Base is the Go type the field is stored as when Type is a named type
+	// or alias of another, e.g. int64 for type UserID int64.
+	Base string
+
+	// Embed marks an embedded struct, replaced by its fields once every
+	// struct is parsed.
+	Embed bool
+}
+
+// Temp returns the name of the intermediate variable of the ith field.
+func (f fieldToken) Temp(i int) string {
+	return fmt.Sprintf("t%d", i)
+}
+
+// Dest returns the argument passed to Scan for the ith field of struct s.
+func (f fieldToken) Dest(i int) string {
+	if f.Sub != nil {
+		return f.composite("&s.")
+	}
+
+	dest := "&s." + f.Name
+	if f.Strategy.Temp != "" {
+		dest = "&" + f.Temp(i)
+	}
+
+	if f.Strategy.Dest != "" {
+		return fmt.Sprintf(f.Strategy.Dest, dest)
+	}
+
+	return dest
+}
+
+// Convert returns the expression converting the ith intermediate variable
+// into the field type.
+func (f fieldToken) Convert(i int) string {
+	return fmt.Sprintf(f.Strategy.Scan, f.Temp(i), f.QualType)
+}
+
+// Unique reports whether the field is tagged unique.
+func (f fieldToken) Unique() bool {
+	_, unique := f.Opts["unique"]
+	return unique
+}
+
+// Version reports whether the field is tagged version, holding the row
+// version checked and incremented by updates.
+func (f fieldToken) Version() bool {
+	_, version := f.Opts["version"]
+	return version
+}
+
+// Auto reports whether the field is tagged auto, generated by the
+// database on insert.
+func (f fieldToken) Auto() bool {
+	_, auto := f.Opts["auto"]
+	return auto
+}
+
+// CaseInsensitive reports whether the field is tagged ci or citext.
+func (f fieldToken) CaseInsensitive() bool {
+	_, ci := f.Opts["ci"]
+	return ci || f.SQLType == "citext"
+}
+
+// Arg returns the query argument for the field of struct v.
+func (f fieldToken) Arg(v string) string {
+	if f.Sub != nil {
+		return f.composite(v + ".")
+	}
+
+	arg := v + "." + f.Name
+	if f.Strategy.Value == "" {
+		return arg
+	}
+
+	return fmt.Sprintf(f.Strategy.Value, arg)
+}
+
+// BindExpr returns the field's placeholder expression for the nth query
+// argument.
+func (f fieldToken) BindExpr(d dialect, n int) string {
+	if f.Strategy.Bind == "" {
+		return d.Placeholder(n)
+	}
+
+	return fmt.Sprintf(f.Strategy.Bind, d.Placeholder(n))
+}
+
+// composite lists the fields of a composite type column, each prefixed
+// with prefix, e.g. pgtype.CompositeFields{&s.Addr.Street, &s.Addr.City}.
+func (f fieldToken) composite(prefix string) string {
+	parts := make([]string, len(f.Sub))
+	for i, sub := range f.Sub {
+		parts[i] = prefix + f.Name + "." + sub.Name
+	}
+
+	return fmt.Sprintf("pgtype.CompositeFields{%s}", strings.Join(parts, ", "))
+}
+
+// SelectExpr returns the field's expression in select lists. Wrapped
+// columns keep their name, so they can be scanned by name.
+func (f fieldToken) SelectExpr(d dialect) string {
+	col := d.ident(f.Column)
+	if f.Strategy.Column == "" {
+		return col
+	}
+
+	return fmt.Sprintf(f.Strategy.Column, col) + " AS " + col
+}
+
+// Param returns the name used when the field is passed as a parameter.
+func (f fieldToken) Param() string {
+	param := lowerInitial(f.Name)
+	if token.Lookup(param).IsKeyword() {
+		param += "Arg"
+	}
+
+	return param
 }
 
 type structToken struct {
 	Import   string
 	Selector string
 	Name     string
-	Fields []fieldToken
+	Table    string
+	Imports  []string // imports of the source file, "name path" if renamed
+	Fields   []fieldToken
+
+	// GoName is the name of the struct in its package when Name, which
+	// generated names are built from, is qualified by -qualify-names.
+	GoName string
+
+	// Timeouts maps read or write to the timeout of the struct's query
+	// helpers of that class, overriding the configured timeouts.
+	Timeouts map[string]string
+
+	// Rank is the field search helpers store the relevance of a row in.
+	Rank *fieldToken
+
+	// Extra is the field name-based scan functions collect unknown
+	// columns in.
+	Extra *fieldToken
+
+	// Hooks holds the names of the hook methods the struct or its pointer
+	// declares, e.g. AfterScan.
+	Hooks map[string]bool
+
+	// Skipped holds the names of the fields tagged db:"-", which still
+	// shadow fields of embedded structs.
+	Skipped []string
+
+	// OptIn reports whether the struct has a //scaneo:generate comment.
+	OptIn bool
+}
+
+// PK returns the primary key field, or nil if the struct has none.
+func (s structToken) PK() *fieldToken {
+	for i := range s.Fields {
+		if s.Fields[i].PK {
+			return &s.Fields[i]
+		}
+	}
+
+	return nil
+}
+
+// VersionField returns the field tagged version, or nil if the struct has
+// none.
+func (s structToken) VersionField() *fieldToken {
+	for i := range s.Fields {
+		if s.Fields[i].Version() {
+			return &s.Fields[i]
+		}
+	}
+
+	return nil
+}
+
+// DeletedAt returns the field marking soft-deleted rows, tagged softdelete
+// or else the deleted_at column, or nil if the struct has none.
+func (s structToken) DeletedAt() *fieldToken {
+	for i := range s.Fields {
+		if _, soft := s.Fields[i].Opts["softdelete"]; soft {
+			return &s.Fields[i]
+		}
+	}
+	for i := range s.Fields {
+		if s.Fields[i].Column == "deleted_at" {
+			return &s.Fields[i]
+		}
+	}
+
+	return nil
+}
+
+// FullText returns the fields tagged fts.
+func (s structToken) FullText() []fieldToken {
+	var fields []fieldToken
+	for _, f := range s.Fields {
+		if _, fts := f.Opts["fts"]; fts {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// Columns returns the column names in scan order.
+func (s structToken) Columns() []string {
+	cols := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		cols[i] = f.Column
+	}
+
+	return cols
+}
+
+// createFields returns the fields inserts take, in argument order: all but
+// an auto-generated primary key.
+func (s structToken) createFields() []fieldToken {
+	var fields []fieldToken
+	for _, f := range s.Fields {
+		if !(f.PK && f.Auto()) {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// updateFields returns the fields updates take, in argument order: the
+// columns set, then the primary key and version they match.
+func (s structToken) updateFields() []fieldToken {
+	var fields []fieldToken
+	for _, f := range s.Fields {
+		if !f.PK && !f.Version() {
+			fields = append(fields, f)
+		}
+	}
+
+	fields = append(fields, *s.PK())
+	if version := s.VersionField(); version != nil {
+		fields = append(fields, *version)
+	}
+
+	return fields
+}
+
+// enumToken is a string type with constants naming its values.
+type enumToken struct {
+	Name   string
+	Consts []string
+}
+
+// Cases returns the constants of e as a case list.
+func (e enumToken) Cases() string {
+	return strings.Join(e.Consts, ", ")
+}
+
+// TypeName returns the struct name as referenced from the generated file.
+func (s structToken) TypeName() string {
+	name := s.Name
+	if s.GoName != "" {
+		name = s.GoName
+	}
+	if s.Selector == "" {
+		return name
+	}
+
+	return s.Selector + "." + name
 }
 
 type importMap map[string][]string
 
+// cType matches field types referring to C types in cgo files, e.g. C.int
+// or *C.char.
+var cType = regexp.MustCompile(`(^|[^\w.])C\.`)
+
+// tagTypes maps db tag options that are shorthands for a SQL type, e.g.
+// db:"ttl,interval", to that type.
+var tagTypes = map[string]string{
+	"citext":   "citext",
+	"hstore":   "hstore",
+	"interval": "interval",
+	"nanos":    "bigint",
+}
+
+// integerTypes lists the integer field types, the types of version fields
+// and of keys read back with LastInsertId.
+var integerTypes = []string{"int", "int32", "int64", "uint", "uint32", "uint64"}
+
 func main() {
 	log.SetFlags(0)
 
-	outFilename := flag.String("o", "scans.go", "")
-	packName := flag.String("p", "current directory", "")
-	unexport := flag.Bool("u", false, "")
-	whitelist := flag.String("w", "", "")
-	version := flag.Bool("v", false, "")
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		if err := inspect(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		if err := initModule(".", os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var opts options
+	flag.StringVar(&opts.Output, "o", "scans.go", "")
+	flag.StringVar(&opts.Package, "p", "current directory", "")
+	flag.BoolVar(&opts.Unexport, "u", false, "")
+	flag.StringVar(&opts.Whitelist, "w", "", "")
+	flag.StringVar(&opts.Exclude, "x", "", "")
+	flag.StringVar(&opts.Dialect, "d", "", "")
+	flag.StringVar(&opts.Funcs, "f", "", "")
+	configPath := flag.String("c", "", "")
+	showVersion := flag.Bool("v", false, "")
 	help := flag.Bool("h", false, "")
-	flag.StringVar(outFilename, "output", "scans.go", "")
-	flag.StringVar(packName, "package", "current directory", "")
-	flag.BoolVar(unexport, "unexport", false, "")
-	flag.StringVar(whitelist, "whitelist", "", "")
-	flag.BoolVar(version, "version", false, "")
+	flag.StringVar(&opts.Output, "output", "scans.go", "")
+	flag.StringVar(&opts.Package, "package", "current directory", "")
+	flag.BoolVar(&opts.Unexport, "unexport", false, "")
+	flag.StringVar(&opts.Whitelist, "whitelist", "", "")
+	flag.StringVar(&opts.WhitelistRegex, "w-regex", "", "")
+	flag.StringVar(&opts.Exclude, "exclude", "", "")
+	flag.StringVar(&opts.Tags, "tags", "", "")
+	flag.BoolVar(&opts.ContinueOnError, "continue-on-error", false, "")
+	flag.BoolVar(&opts.QualifyNames, "qualify-names", false, "")
+	flag.StringVar(&opts.SkipDirs, "skip-dirs", "", "")
+	flag.BoolVar(&opts.FollowSymlinks, "follow-symlinks", false, "")
+	flag.BoolVar(&opts.ExportedOnly, "exported-only", false, "")
+	flag.StringVar(&opts.Dialect, "dialect", "", "")
+	flag.StringVar(&opts.Driver, "driver", "database/sql", "")
+	flag.StringVar(&opts.Funcs, "funcs", "", "")
+	flag.StringVar(&opts.Schema, "schema", "", "")
+	flag.IntVar(&opts.BatchSize, "batch-size", 500, "")
+	flag.IntVar(&opts.MaxParams, "max-params", 0, "")
+	flag.IntVar(&opts.MaxRows, "max-rows", 0, "")
+	flag.IntVar(&opts.CheckRows, "check-rows", 0, "")
+	flag.BoolVar(&opts.Repo, "repo", false, "")
+	flag.IntVar(&opts.RetryTx, "retry-tx", 0, "")
+	flag.BoolVar(&opts.Strict, "strict", false, "")
+	flag.BoolVar(&opts.Validate, "validate", false, "")
+	flag.BoolVar(&opts.Audit, "audit", false, "")
+	flag.BoolVar(&opts.Otel, "otel", false, "")
+	flag.BoolVar(&opts.LogQueries, "log-queries", false, "")
+	flag.BoolVar(&opts.StrictFields, "strict-fields", false, "")
+	flag.StringVar(&opts.Layout, "layout", "single", "")
+	flag.BoolVar(&opts.ByName, "by-name", false, "")
+	flag.BoolVar(&opts.Maps, "maps", false, "")
+	flag.BoolVar(&opts.Stream, "stream", false, "")
+	flag.BoolVar(&opts.Iter, "iter", false, "")
+	flag.BoolVar(&opts.RowTo, "row-to", false, "")
+	flag.StringVar(&opts.UnknownColumns, "unknown-columns", "error", "")
+	flag.BoolVar(&opts.QuoteIdentifiers, "quote-identifiers", false, "")
+	flag.BoolVar(&opts.LooseTypes, "loose-types", false, "")
+	flag.BoolVar(&opts.Fixtures, "fixtures", false, "")
+	flag.Int64Var(&opts.Seed, "seed", 1, "")
+	flag.BoolVar(&opts.NamedArgs, "named-args", false, "")
+	flag.BoolVar(&opts.MapFuncs, "map-funcs", false, "")
+	flag.BoolVar(&opts.Enums, "enums", false, "")
+	flag.BoolVar(&opts.Squirrel, "squirrel", false, "")
+	flag.StringVar(&opts.Summary, "summary", "", "")
+	flag.StringVar(configPath, "config", "", "")
+	flag.BoolVar(showVersion, "version", false, "")
 	flag.BoolVar(help, "help", false, "")
-	flag.Usage = func() { log.Println(usageText) } // call on flag error
+	flag.Usage = func() { log.Print(usageText) } // call on flag error
 	flag.Parse()
 
-	if *help {
-		// not an error, send to stdout
-		// that way people can: scaneo -h | less
-		fmt.Println(usageText)
-		return
+	if *configPath != "" {
+		if err := loadConfig(*configPath, &opts); err != nil {
+			log.Fatal("couldn't load config:", err)
+		}
+
+		// parse again so command line flags win over the config file
+		flag.Parse()
+	}
+
+	outputSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "o" || f.Name == "output" {
+			outputSet = true
+		}
+	})
+	if contains(flag.Args(), "-") && !outputSet {
+		// a pipeline stage, writing where it reads from
+		opts.Output = "-"
+	}
+
+	if err := opts.check(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *help {
+		// not an error, send to stdout
+		// that way people can: scaneo -h | less
+		fmt.Print(usageText)
+		return
+	}
+
+	if *showVersion {
+		fmt.Println("scaneo version", version)
+		return
+	}
+
+	if opts.Package == "current directory" {
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatal("couldn't get working directory:", err)
+		}
+
+		opts.Package = filepath.Base(wd)
+	}
+
+	if opts.Tags != "" {
+		buildContext.BuildTags = strings.Split(opts.Tags, ",")
+	}
+
+	importmap, err := findFiles(flag.Args(), &opts)
+	if err != nil {
+		log.Println("couldn't find files:", err)
+		log.Fatal(usageText)
+	}
+
+	var enums []enumToken
+	if opts.Enums {
+		for targetImport, paths := range importmap {
+			if targetImport != "" {
+				log.Printf("skipping enums of %s, their methods must be generated in their own package", targetImport)
+				continue
+			}
+
+			toks, err := parseEnums(paths)
+			if err != nil {
+				log.Fatal(describeParseError(err))
+			}
+			enums = append(enums, toks...)
+		}
+	}
+
+	importmap = aliasImports(importmap)
+	pkgs := loadPackages(importmap)
+
+	filter, err := opts.structFilter()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var files []outputFile
+	for _, opts := range opts.perDialect() {
+		// types map per dialect, so each dialect parses on its own
+		structToks := make([]structToken, 0, 8)
+		failed := 0
+		for targetImport, targetPathSlice := range importmap {
+			for _, targetPath := range targetPathSlice {
+				toks, err := parseCode(targetImport, targetPath, &opts)
+				if err != nil {
+					// report every broken file, not just the first
+					log.Print(describeParseError(err))
+					failed++
+					continue
+				}
+
+				structToks = append(structToks, toks...)
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("couldn't parse %d source files", failed)
+		}
+
+		if unmatched := filter.unmatched(structToks); len(unmatched) > 0 {
+			// most likely a struct was renamed
+			log.Fatalf("whitelisted structs not found: %s", strings.Join(unmatched, ", "))
+		}
+
+		if opts.Whitelist == "" && opts.WhitelistRegex == "" {
+			structToks = optedIn(structToks)
+		}
+
+		if err := resolveEmbeds(structToks, importmap, &opts); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := resolveComposites(structToks, importmap, &opts); err != nil {
+			log.Fatal(err)
+		}
+
+		resolveHooks(structToks, pkgs)
+		resolveTypes(structToks, pkgs)
+		if err := resolveBaseTypes(structToks, pkgs, &opts); err != nil {
+			log.Fatal(err)
+		}
+		resolveScanners(structToks)
+		if err := resolveNameCollisions(structToks, &opts); err != nil {
+			log.Fatal(err)
+		}
+
+		dialectFiles, err := genFile(&opts, structToks, enums)
+		if err != nil {
+			log.Fatal("couldn't generate file:", err)
+		}
+		files = append(files, dialectFiles...)
+	}
+
+	if opts.Summary != "" {
+		w := os.Stdout
+		if opts.Output == "-" {
+			// keep the generated code alone on stdout
+			w = os.Stderr
+		}
+		if err := writeSummary(w, opts.Summary, files); err != nil {
+			log.Fatal("couldn't write summary:", err)
+		}
+	}
+}
+
+// packageStructs looks up structs by name among toks, then in the files of
+// their package, so structs may refer to structs declared in files scaneo
+// isn't given.
+type packageStructs struct {
+	toks      []structToken
+	importmap importMap
+	opts      *options
+
+	// parsed holds the structs parsed from package files, by import and
+	// name
+	parsed map[string][]structToken
+}
+
+// lookup returns the struct name of the package of targetImport, or nil
+// when the package declares none.
+func (p *packageStructs) lookup(targetImport, name string) (*structToken, error) {
+	for i := range p.toks {
+		if p.toks[i].Import == targetImport && p.toks[i].Name == name {
+			return &p.toks[i], nil
+		}
+	}
+
+	key := targetImport + "." + name
+	if _, found := p.parsed[key]; !found {
+		if p.parsed == nil {
+			p.parsed = make(map[string][]structToken)
+		}
+
+		whitelisted := *p.opts
+		whitelisted.Whitelist = name
+		whitelisted.WhitelistRegex = ""
+		whitelisted.Exclude = ""
+		for _, path := range packageFiles(p.importmap[targetImport]) {
+			found, err := parseCode(targetImport, path, &whitelisted)
+			if err != nil {
+				return nil, err
+			}
+			p.parsed[key] = append(p.parsed[key], found...)
+		}
+	}
+	if found := p.parsed[key]; len(found) > 0 {
+		return &found[0], nil
+	}
+
+	return nil, nil
+}
+
+// resolveEmbeds replaces the embedded structs of toks with their fields,
+// where they are embedded, so they keep the declaration order, and expands
+// struct fields tagged prefix into their prefixed columns, e.g. Address
+// tagged db:"address,prefix=addr_" into addr_street and addr_city. The
+// structs are looked up among toks, then in the package files of
+// importmap. Fields of the embedding struct shadow those of the embedded
+// ones, like Go selectors do.
+func resolveEmbeds(toks []structToken, importmap importMap, opts *options) error {
+	structs := packageStructs{toks: toks, importmap: importmap, opts: opts}
+	lookup := structs.lookup
+
+	// names of the structs being flattened, to catch structs embedding
+	// themselves
+	var embedding []string
+	var flatten func(tok *structToken) ([]fieldToken, error)
+	var expand func(tok *structToken, f fieldToken, prefix string) ([]fieldToken, error)
+	flatten = func(tok *structToken) ([]fieldToken, error) {
+		if contains(embedding, tok.Name) {
+			return nil, fmt.Errorf("struct %s embeds itself", tok.Name)
+		}
+		embedding = append(embedding, tok.Name)
+		defer func() { embedding = embedding[:len(embedding)-1] }()
+
+		direct := make(map[string]bool)
+		for _, f := range tok.Fields {
+			if !f.Embed {
+				direct[f.Name] = true
+			}
+		}
+		for _, name := range tok.Skipped {
+			direct[name] = true
+		}
+		for _, f := range []*fieldToken{tok.Rank, tok.Extra} {
+			if f != nil {
+				direct[f.Name] = true
+			}
+		}
+
+		fields := make([]fieldToken, 0, len(tok.Fields))
+		promoted := make(map[string]string)
+		for _, f := range tok.Fields {
+			if prefix, nested := f.Opts["prefix"]; nested {
+				sub, err := expand(tok, f, prefix)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, sub...)
+				continue
+			}
+			if !f.Embed {
+				fields = append(fields, f)
+				continue
+			}
+
+			embedded, err := lookup(tok.Import, f.Type)
+			if err != nil {
+				return nil, err
+			}
+			if embedded == nil {
+				log.Printf("struct %s: skipping embedded %s, no struct of that name in its package", tok.Name, f.Type)
+				continue
+			}
+
+			sub, err := flatten(embedded)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range sub {
+				if direct[s.Name] {
+					continue
+				}
+				if other, clash := promoted[s.Name]; clash {
+					return nil, fmt.Errorf("struct %s: embedded %s and %s both have field %s, tag one of them db:\"-\"",
+						tok.Name, other, f.Type, s.Name)
+				}
+				promoted[s.Name] = f.Type
+				fields = append(fields, s)
+			}
+		}
+
+		return fields, nil
+	}
+
+	expand = func(tok *structToken, f fieldToken, prefix string) ([]fieldToken, error) {
+		nested, err := lookup(tok.Import, f.Type)
+		if err != nil {
+			return nil, err
+		}
+		if nested == nil {
+			return nil, fmt.Errorf("struct %s: prefixed field %s must be a struct of its package, got %s", tok.Name, f.Name, f.Type)
+		}
+
+		sub, err := flatten(nested)
+		if err != nil {
+			return nil, err
+		}
+		if prefix == "" {
+			// db:"address,prefix" prefixes with the column, address_
+			prefix = f.Column + "_"
+		}
+		for i := range sub {
+			for _, opt := range []string{"pk", "unique", "version"} {
+				if _, tagged := sub[i].Opts[opt]; tagged {
+					return nil, fmt.Errorf("struct %s: field %s of prefixed field %s can't be tagged %s", tok.Name, sub[i].Name, f.Name, opt)
+				}
+			}
+			sub[i].Name = f.Name + "." + sub[i].Name
+			sub[i].Column = prefix + sub[i].Column
+		}
+
+		return sub, nil
+	}
+
+	for i := range toks {
+		if !embeds(toks[i]) {
+			continue
+		}
+
+		fields, err := flatten(&toks[i])
+		if err != nil {
+			return err
+		}
+
+		// only tagged keys stand, the id column fallback is redone with
+		// every field in
+		for j := range fields {
+			_, fields[j].PK = fields[j].Opts["pk"]
+		}
+		toks[i].Fields = fields
+		if err := checkCurrencyFields(toks[i]); err != nil {
+			return fmt.Errorf("struct %s: %s", toks[i].Name, err)
+		}
+		defaultPK(&toks[i])
+	}
+
+	return nil
+}
+
+// embeds tells whether tok embeds a struct, or nests one under a prefix.
+func embeds(tok structToken) bool {
+	for _, f := range tok.Fields {
+		if _, nested := f.Opts["prefix"]; f.Embed || nested {
+			return true
+		}
+	}
+
+	return false
+}
+
+// structFilter chooses structs by the names and glob patterns listed with
+// -w, and by the regular expression of -w-regex, then leaves out those
+// listed with -x.
+type structFilter struct {
+	names   []string
+	regex   *regexp.Regexp
+	exclude []string
+}
+
+// structFilter returns the filter of o's whitelist options.
+func (o *options) structFilter() (structFilter, error) {
+	var filter structFilter
+	if o.Whitelist != "" {
+		filter.names = strings.Split(o.Whitelist, ",")
+	}
+	for _, name := range filter.names {
+		if _, err := filepath.Match(name, ""); err != nil {
+			return filter, fmt.Errorf("whitelist pattern %q: %v", name, err)
+		}
+	}
+
+	if o.Exclude != "" {
+		filter.exclude = strings.Split(o.Exclude, ",")
+	}
+	for _, name := range filter.exclude {
+		if _, err := filepath.Match(name, ""); err != nil {
+			return filter, fmt.Errorf("exclude pattern %q: %v", name, err)
+		}
+	}
+
+	if o.WhitelistRegex != "" {
+		regex, err := regexp.Compile(o.WhitelistRegex)
+		if err != nil {
+			return filter, fmt.Errorf("whitelist regex: %v", err)
+		}
+		filter.regex = regex
+	}
+
+	return filter, nil
+}
+
+// match reports whether the struct called name is included. Without
+// whitelist options every struct not excluded is.
+func (f structFilter) match(name string) bool {
+	if matchAny(f.exclude, name) {
+		return false
+	}
+	if f.names == nil && f.regex == nil {
+		return true
+	}
+
+	return matchAny(f.names, name) || f.regex != nil && f.regex.MatchString(name)
+}
+
+// unmatched returns the -w entries, and the -w-regex expression, matching
+// none of toks.
+func (f structFilter) unmatched(toks []structToken) []string {
+	var unmatched []string
+	for _, pattern := range f.names {
+		found := false
+		for _, tok := range toks {
+			if matchAny([]string{pattern}, tok.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+
+	if f.regex != nil {
+		found := false
+		for _, tok := range toks {
+			if f.regex.MatchString(tok.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, f.regex.String())
+		}
+	}
+
+	return unmatched
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// named reports whether -w lists the struct called name literally, rather
+// than through a pattern.
+func (f structFilter) named(name string) bool {
+	return contains(f.names, name)
+}
+
+// resolveNameCollisions fails when structs of different packages share a
+// name, so the names of their generated functions would collide. With
+// opts.QualifyNames, it prefixes the names of the imported ones with their
+// package instead, e.g. ScanModelsPost.
+func resolveNameCollisions(toks []structToken, opts *options) error {
+	byName := make(map[string][]int)
+	var names []string
+	for i, tok := range toks {
+		if byName[tok.Name] == nil {
+			names = append(names, tok.Name)
+		}
+		byName[tok.Name] = append(byName[tok.Name], i)
+	}
+
+	for _, name := range names {
+		if len(byName[name]) < 2 {
+			continue
+		}
+
+		if !opts.QualifyNames {
+			var pkgs []string
+			for _, i := range byName[name] {
+				pkg := toks[i].Import
+				if pkg == "" {
+					pkg = "the generated package"
+				} else if j := strings.IndexByte(pkg, ' '); j > 0 {
+					pkg = pkg[j+1:]
+				}
+				pkgs = append(pkgs, pkg)
+			}
+			return fmt.Errorf("structs named %s in %s would generate colliding functions, rename them or use -qualify-names", name, strings.Join(pkgs, " and "))
+		}
+
+		for _, i := range byName[name] {
+			if toks[i].Selector != "" {
+				toks[i].GoName = name
+				toks[i].Name = upperInitial(toks[i].Selector) + name
+			}
+		}
+	}
+
+	return nil
+}
+
+// optedIn returns the structs of toks with a //scaneo:generate comment, or
+// all of them when none has one.
+func optedIn(toks []structToken) []structToken {
+	var chosen []structToken
+	for _, tok := range toks {
+		if tok.OptIn {
+			chosen = append(chosen, tok)
+		}
+	}
+	if chosen == nil {
+		return toks
+	}
+
+	return chosen
+}
+
+// resolveComposites fills in the fields of columns tagged composite from
+// the struct declaring their type, which must be in their package.
+func resolveComposites(toks []structToken, importmap importMap, opts *options) error {
+	structs := packageStructs{toks: toks, importmap: importmap, opts: opts}
+	for i := range toks {
+		for j := range toks[i].Fields {
+			f := &toks[i].Fields[j]
+			if _, composite := f.Opts["composite"]; !composite {
+				continue
+			}
+
+			sub, err := structs.lookup(toks[i].Import, f.Type)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				return fmt.Errorf("struct %s: composite field %s needs struct %s in its package", toks[i].Name, f.Name, f.Type)
+			}
+
+			// structs parsed from other files have their embedded
+			// structs to flatten still
+			flat := []structToken{*sub}
+			if err := resolveEmbeds(flat, importmap, opts); err != nil {
+				return err
+			}
+			f.Sub = flat[0].Fields
+		}
+	}
+
+	return nil
+}
+
+// hookParams maps the names of the methods generated code calls when a
+// struct declares them to whether they take a context.Context. All of them
+// return an error.
+var hookParams = map[string]bool{
+	"BeforeInsert": true,
+	"AfterScan":    true,
+	"Validate":     false,
+}
+
+// resolveHooks fills in the hook methods of toks from pkgs, keyed by target
+// import. Methods are looked up in the method set of the struct's pointer,
+// so hooks with value receivers and hooks promoted from embedded types, of
+// any package, count.
+func resolveHooks(toks []structToken, pkgs map[string]*types.Package) {
+	for i := range toks {
+		pkg := pkgs[toks[i].Import]
+		if pkg == nil {
+			continue
+		}
+		obj, isType := pkg.Scope().Lookup(toks[i].Name).(*types.TypeName)
+		if !isType {
+			continue
+		}
+
+		mset := types.NewMethodSet(types.NewPointer(obj.Type()))
+		for name, withCtx := range hookParams {
+			sel := mset.Lookup(nil, name)
+			if sel == nil || !isHook(sel.Type().(*types.Signature), withCtx) {
+				continue
+			}
+			if toks[i].Hooks == nil {
+				toks[i].Hooks = make(map[string]bool)
+			}
+			toks[i].Hooks[name] = true
+		}
+	}
+}
+
+// parseEnums returns the string types declared in the files at paths with
+// typed constants and without Scan or Value methods, sorted by name. The
+// constants and methods may be declared in any file of their package.
+func parseEnums(paths []string) ([]enumToken, error) {
+	strs := make(map[string]bool)
+	consts := make(map[string][]string)
+	methods := make(map[string]bool)
+	values := make(map[string]bool) // type name = value
+	for n, path := range packageFiles(paths) {
+		astf, err := parseFile(token.NewFileSet(), path, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range astf.Decls {
+			if fn, isFunc := decl.(*ast.FuncDecl); isFunc {
+				if fn.Recv != nil && (fn.Name.Name == "Scan" || fn.Name.Name == "Value") {
+					recv := fn.Recv.List[0].Type
+					if star, isStar := recv.(*ast.StarExpr); isStar {
+						recv = star.X
+					}
+					if ident, isIdent := recv.(*ast.Ident); isIdent {
+						methods[ident.Name] = true
+					}
+				}
+				continue
+			}
+
+			genDecl := decl.(*ast.GenDecl)
+			for _, spec := range genDecl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					// packageFiles lists the files at paths first
+					if ident, isIdent := spec.Type.(*ast.Ident); isIdent && ident.Name == "string" && spec.Assign == 0 && n < len(paths) {
+						strs[spec.Name.Name] = true
+					}
+				case *ast.ValueSpec:
+					// only constants with a string literal of their own, so
+					// no two share a value
+					typ, isIdent := spec.Type.(*ast.Ident)
+					if genDecl.Tok != token.CONST || !isIdent || len(spec.Values) != len(spec.Names) {
+						continue
+					}
+					for i, name := range spec.Names {
+						lit, isLit := spec.Values[i].(*ast.BasicLit)
+						if name.Name == "_" || !isLit || lit.Kind != token.STRING {
+							continue
+						}
+						value, _ := strconv.Unquote(lit.Value)
+						if values[typ.Name+"="+value] {
+							continue
+						}
+						values[typ.Name+"="+value] = true
+						consts[typ.Name] = append(consts[typ.Name], name.Name)
+					}
+				}
+			}
+		}
+	}
+
+	var enums []enumToken
+	for name := range strs {
+		if len(consts[name]) > 0 && !methods[name] {
+			enums = append(enums, enumToken{Name: name, Consts: consts[name]})
+		}
+	}
+	sort.Slice(enums, func(i, j int) bool { return enums[i].Name < enums[j].Name })
+
+	return enums, nil
+}
+
+// converts reports whether f goes through a strategy picked by its Go type,
+// rather than by its tag, that converts its Go value on the way in or out.
+func (f fieldToken) converts() bool {
+	if f.typedByTag() {
+		return false
+	}
+
+	return f.Strategy.Temp != "" || f.Strategy.Dest != "" || f.Strategy.Value != ""
+}
+
+// typedByTag reports whether the tag of f picks its SQL type or strategy.
+func (f fieldToken) typedByTag() bool {
+	if _, tagged := f.Opts["type"]; tagged {
+		return true
+	}
+	for opt := range tagTypes {
+		if _, tagged := f.Opts[opt]; tagged {
+			return true
+		}
+	}
+
+	_, money := f.Opts["money"]
+	return money
+}
+
+// comparable reports whether values of the field can be compared with ==,
+// guessing from its Type when it didn't type-check.
+func (f fieldToken) comparable() bool {
+	if f.GoType != nil {
+		return types.Comparable(f.GoType)
+	}
+
+	return comparable(f.Type)
+}
+
+// BaseType returns the Go type the field is stored as, its Type unless
+// type checking resolved it to another, e.g. int64 for type UserID int64.
+func (f fieldToken) BaseType() string {
+	if f.Base != "" {
+		return f.Base
+	}
+
+	return f.Type
+}
+
+// loadPackages type-checks the packages of importmap, keyed by target
+// import. Type errors are logged, and types they involve don't resolve;
+// packages that don't load at all are nil.
+func loadPackages(importmap importMap) map[string]*types.Package {
+	pkgs := make(map[string]*types.Package, len(importmap))
+	for targetImport, paths := range importmap {
+		pkg, err := typeCheck(packageFiles(paths))
+		if err != nil {
+			log.Printf("warning: %s, types it involves won't resolve", err)
+		}
+		pkgs[targetImport] = pkg
+	}
+
+	return pkgs
+}
+
+// buildContext decides which files of source directories are parsed, by
+// their build constraints and the tags set with -tags.
+var buildContext = build.Default
+
+// packageFiles returns paths and the other files of their packages the go
+// tool would build, so types declared in files scaneo isn't given resolve
+// too. Files scaneo generated are left out, they may be stale.
+func packageFiles(paths []string) []string {
+	files := append([]string(nil), paths...)
+	given := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		given[filepath.Clean(path)] = true
+	}
+
+	dirs := make(map[string]bool)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if dirs[dir] || path == stdinPath {
+			continue
+		}
+		dirs[dir] = true
+
+		bpkg, err := buildContext.ImportDir(dir, 0)
+		if err != nil {
+			continue
+		}
+		for _, name := range append(bpkg.GoFiles, bpkg.CgoFiles...) {
+			path := filepath.Join(dir, name)
+			if given[path] {
+				continue
+			}
+			if _, err := readStamp(path); err == nil {
+				continue
+			}
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+// resolveTypes sets the GoType of the fields of toks from pkgs, keyed by
+// target import.
+func resolveTypes(toks []structToken, pkgs map[string]*types.Package) {
+	for i := range toks {
+		for j := range toks[i].Fields {
+			f := &toks[i].Fields[j]
+			f.GoType = fieldType(pkgs[toks[i].Import], toks[i].Name, f.Name)
+		}
+	}
+}
+
+// resolveBaseTypes maps fields whose types are named types or aliases
+// missing from the type tables as the types they stand for, e.g. type
+// UserID int64 as int64 and type Email = string as string. Conversions of
+// their strategies go through the field type. Fields typed by their tag
+// keep their strategies.
+func resolveBaseTypes(toks []structToken, pkgs map[string]*types.Package, opts *options) error {
+	for i := range toks {
+		for j := range toks[i].Fields {
+			f := &toks[i].Fields[j]
+			if f.GoType != nil && opts.sqlType(f.Type) == "" {
+				if base := baseType(f.GoType, pkgs[toks[i].Import]); base != f.Type {
+					f.Base = base
+				}
+			}
+
+			if f.Base != "" && f.SQLType == "" && f.Sub == nil && !f.typedByTag() {
+				if sqlType := opts.sqlType(f.Base); sqlType != "" {
+					strat, err := opts.strategy(sqlType)
+					if err != nil {
+						return fmt.Errorf("struct %s: %s", toks[i].Name, err)
+					}
+
+					f.SQLType = sqlType
+					f.Strategy = convertThrough(strat, f.Base, types.Identical(f.GoType, f.GoType.Underlying()))
+				}
+			}
+
+			if f.Version() && !contains(integerTypes, f.BaseType()) {
+				return fmt.Errorf("struct %s: version field %s must be an integer, got %s", toks[i].Name, f.Name, f.Type)
+			}
+		}
+	}
+
+	return nil
+}
+
+// baseType returns the Go type t is stored as, written as in pkg: its
+// underlying type when that is a builtin, slice or map, e.g. int64 for type
+// UserID int64 and []string for type Tags []string, and t itself
+// otherwise, e.g. time.Time for type When = time.Time.
+func baseType(t types.Type, pkg *types.Package) string {
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+
+	if ptr, isPtr := t.(*types.Pointer); isPtr {
+		return "*" + baseType(ptr.Elem(), pkg)
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Name()
+	case *types.Slice:
+		if elem, isBasic := u.Elem().(*types.Basic); isBasic && elem.Kind() == types.Byte {
+			return "[]byte"
+		}
+		return types.TypeString(u, qualifier)
+	case *types.Map:
+		return types.TypeString(u, qualifier)
+	}
+
+	return types.TypeString(t, qualifier)
+}
+
+// convertThrough adapts strat, written for base, to a named type of base:
+// scanned values are converted to the field type and values passed to
+// queries to base. Unnamed types, e.g. aliases of base, take strat as it
+// is.
+func convertThrough(strat strategy, base string, unnamed bool) strategy {
+	if unnamed {
+		return strat
+	}
+
+	if strat.Scan != "" && strat.Scan != "%[2]s(%[1]s)" {
+		strat.Scan = "%[2]s(" + strat.Scan + ")"
+	}
+	if strat.Value != "" && !isConversion(strat.Value) {
+		strat.Value = strings.Replace(strat.Value, "%s", base+"(%s)", 1)
+	}
+
+	return strat
+}
+
+// isConversion reports whether value converts %s to a builtin type, e.g.
+// int64(%s), which takes named types of any base as they are.
+func isConversion(value string) bool {
+	name := strings.TrimSuffix(value, "(%s)")
+	_, isType := types.Universe.Lookup(name).(*types.TypeName)
+	return name != value && isType
+}
+
+// resolveScanners drops the Go conversions of fields whose types implement
+// sql.Scanner or driver.Valuer themselves. Column and bind wrappers stay,
+// they shape what the database sends and takes. Fields whose types didn't
+// resolve, e.g. from packages the type checker can't find, keep their
+// strategies.
+func resolveScanners(toks []structToken) {
+	for i := range toks {
+		for j := range toks[i].Fields {
+			f := &toks[i].Fields[j]
+			if !f.converts() || f.GoType == nil {
+				continue
+			}
+
+			t := f.GoType
+			if ptr, isPtr := t.(*types.Pointer); isPtr {
+				t = ptr.Elem()
+			}
+
+			if hasMethod(types.NewPointer(t), "Scan", isScan) {
+				f.Strategy.Temp, f.Strategy.Scan, f.Strategy.Dest = "", "", ""
+			}
+			if hasMethod(t, "Value", isValue) {
+				f.Strategy.Value = ""
+			}
+		}
+	}
+}
+
+// fieldType returns the type of the field of struct structName in pkg, or
+// nil when it doesn't resolve.
+func fieldType(pkg *types.Package, structName, fieldName string) types.Type {
+	if pkg == nil {
+		return nil
+	}
+
+	obj := pkg.Scope().Lookup(structName)
+	if obj == nil {
+		return nil
+	}
+	if _, isStruct := obj.Type().Underlying().(*types.Struct); !isStruct {
+		return nil
+	}
+
+	// fields of embedded structs are promoted, those of prefixed struct
+	// fields are named by their path, e.g. Address.Street
+	t := obj.Type()
+	for _, name := range strings.Split(fieldName, ".") {
+		v, _, _ := types.LookupFieldOrMethod(t, false, pkg, name)
+		field, isVar := v.(*types.Var)
+		if !isVar || field.Type() == types.Typ[types.Invalid] {
+			return nil
+		}
+		t = field.Type()
+	}
+
+	return t
+}
+
+// hasMethod reports whether the method set of t has a method name whose
+// signature satisfies match.
+func hasMethod(t types.Type, name string, match func(*types.Signature) bool) bool {
+	sel := types.NewMethodSet(t).Lookup(nil, name)
+	if sel == nil {
+		return false
+	}
+
+	sig, isSig := sel.Type().(*types.Signature)
+	return isSig && match(sig)
+}
+
+// isScan reports whether sig is that of sql.Scanner's Scan(interface{}) error.
+func isScan(sig *types.Signature) bool {
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 {
+		return false
+	}
+
+	iface, isIface := sig.Params().At(0).Type().Underlying().(*types.Interface)
+	return isIface && iface.Empty() && isError(sig.Results().At(0).Type())
+}
+
+// isValue reports whether sig is that of driver.Valuer's
+// Value() (driver.Value, error).
+func isValue(sig *types.Signature) bool {
+	if sig.Params().Len() != 0 || sig.Results().Len() != 2 {
+		return false
+	}
+
+	named, isNamed := sig.Results().At(0).Type().(*types.Named)
+	return isNamed && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "database/sql/driver" &&
+		named.Obj().Name() == "Value" && isError(sig.Results().At(1).Type())
+}
+
+// isError reports whether t is the predeclared error type.
+func isError(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// isHook reports whether a method of type sig returns an error and takes a
+// context.Context, or nothing without withCtx.
+func isHook(sig *types.Signature, withCtx bool) bool {
+	if sig.Results().Len() != 1 || !isError(sig.Results().At(0).Type()) {
+		return false
+	}
+
+	if !withCtx {
+		return sig.Params().Len() == 0
+	}
+
+	return sig.Params().Len() == 1 && !sig.Variadic() &&
+		types.TypeString(sig.Params().At(0).Type(), nil) == "context.Context"
+}
+
+// typeCheck type-checks the files at paths as one package. Type errors, such
+// as imports that don't resolve, don't stop it: the package is returned
+// with whatever resolved typed, along with the first error. The package is
+// nil when a file doesn't parse.
+//
+// Sources are type-checked with go/types and the source importer rather than
+// go/packages, which isn't in the standard library scaneo sticks to.
+func typeCheck(paths []string) (*types.Package, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		astf, err := parseFile(fset, path, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, astf)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files to type-check")
+	}
+
+	var first error
+	conf := types.Config{
+		Importer:    importer.ForCompiler(fset, "source", nil),
+		FakeImportC: true,
+		Error: func(err error) {
+			if first == nil {
+				first = err
+			}
+		},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, nil)
+	return pkg, first
+}
+
+// findFiles maps the import path of each target to its source files.
+// Targets are source paths or, when no such path exists, import paths of
+// packages the go tool finds, in GOPATH, modules or vendor directories. Files
+// of directories and packages leave out tests, generated files and the files
+// scaneo is about to write with opts. Directories that can't be read fail the walk,
+// unless opts.ContinueOnError has them logged and skipped.
+func findFiles(paths []string, opts *options) (importMap, error) {
+	if len(paths) < 1 {
+		return nil, errors.New("no starting paths")
+	}
+
+	skip := make(map[string]bool)
+	for _, opts := range opts.perDialect() {
+		for _, output := range []string{opts.Output, partFile(opts.Output, "read"), partFile(opts.Output, "write")} {
+			if abs, err := filepath.Abs(output); err == nil {
+				skip[abs] = true
+			}
+		}
+	}
+
+	// using map to prevent duplicate file path entries
+	// in case the user accidently passes the same file path more than once
+	// probably because of autocomplete
+	files := make(map[string]map[string]bool)
+
+	outputDir, err := filepath.Abs(filepath.Dir(opts.Output))
+	if err != nil {
+		return nil, err
+	}
+	// include reports whether fp, a Go file the package builds, is parsed
+	include := func(fp string) bool {
+		if abs, err := filepath.Abs(fp); err == nil && skip[abs] {
+			// parsing it would duplicate what's generated into it
+			return false
+		} else if _, err := readStamp(fp); err == nil {
+			// generated by an earlier run into the source package
+			return false
+		}
+
+		return !isGenerated(fp)
+	}
+
+	skipDirs := opts.skipDirs()
+	walked := make(map[string]bool)
+
+	inferred := make(map[string]string)
+	add := func(targetImport, path string, infer bool) {
+		dir := filepath.Dir(path)
+		if infer {
+			if _, found := inferred[dir]; !found {
+				inferred[dir] = inferImport(dir)
+			}
+			targetImport = inferred[dir]
+		}
+		if abs, err := filepath.Abs(dir); err == nil && abs == outputDir {
+			// the generated package, which can't import itself nor
+			// qualify its own types
+			targetImport = ""
+		}
+
+		if _, found := files[targetImport]; !found {
+			files[targetImport] = make(map[string]bool)
+		}
+		files[targetImport][path] = true
+	}
+
+	for _, target := range paths {
+		if target == "-" {
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, err
+			}
+			stdinSource = src
+			add("", stdinPath, false)
+			continue
+		}
+
+		// without an import path, it's inferred from the source directory
+		targetImport, targetPath, infer := "", target, true
+		if i := strings.Index(target, "="); i >= 0 {
+			// import paths can't contain =, source paths can
+			targetImport, targetPath, infer = target[:i], target[i+1:], false
+		}
+		info, err := os.Stat(targetPath)
+		if err != nil && infer && strings.Contains(target, "@") {
+			// a package of a module version, e.g. example.com/m/models@v1.4.0
+			importPath, dir, err := downloadPackage(target)
+			if err != nil {
+				return nil, err
+			}
+
+			bpkg, err := buildContext.ImportDir(dir, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range append(bpkg.GoFiles, bpkg.CgoFiles...) {
+				if path := filepath.Join(dir, name); include(path) {
+					add(importPath, path, false)
+				}
+			}
+			continue
+		}
+		if err != nil && infer {
+			// not on disk, maybe an import path
+			bpkg, importErr := buildContext.Import(target, ".", 0)
+			if importErr != nil {
+				return nil, fmt.Errorf("%v, and it isn't an importable package: %v", err, importErr)
+			}
+
+			targetImport = bpkg.ImportPath
+			for _, name := range append(bpkg.GoFiles, bpkg.CgoFiles...) {
+				if path := filepath.Join(bpkg.Dir, name); include(path) {
+					add(targetImport, path, false)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			// add file path to files
+			add(targetImport, targetPath, infer)
+			continue
+		}
+
+		// walk walks root, which walkFile visits the files of
+		var walk func(root string) error
+		walkFile := func(root string) filepath.WalkFunc {
+			return func(fp string, fi os.FileInfo, err error) error {
+				if err != nil {
+					if !opts.ContinueOnError {
+						return err
+					}
+					log.Printf("skipping %s: %v", fp, err)
+					return nil
+				}
+
+				if fp != root && contains(skipDirs, fi.Name()) {
+					if fi.IsDir() {
+						// e.g. vendored copies of types
+						return filepath.SkipDir
+					}
+					if fi.Mode()&os.ModeSymlink != 0 {
+						return nil
+					}
+				}
+
+				if fi.Mode()&os.ModeSymlink != 0 {
+					if linked, err := os.Stat(fp); err == nil && linked.IsDir() {
+						// Walk doesn't follow links by itself
+						if !opts.FollowSymlinks {
+							return nil
+						}
+						return walk(fp)
+					}
+				}
+
+				if fi.IsDir() {
+					// will still enter directory
+					return nil
+				} else if fi.Name()[0] == '.' {
+					return nil
+				} else if filepath.Ext(fi.Name()) != ".go" {
+					// assembly, C and other files next to Go code
+					return nil
+				} else if strings.HasSuffix(fi.Name(), "_test.go") {
+					return nil
+				} else if match, err := buildContext.MatchFile(filepath.Dir(fp), fi.Name()); err == nil && !match {
+					// excluded by build constraints
+					return nil
+				} else if !include(fp) {
+					return nil
+				}
+
+				// add file path to files
+				add(targetImport, fp, infer)
+				return nil
+			}
+		}
+		walk = func(root string) error {
+			real, err := filepath.EvalSymlinks(root)
+			if err != nil {
+				return err
+			}
+			if walked[real] {
+				// a symlink loop, or a directory linked to twice
+				return nil
+			}
+			walked[real] = true
+
+			// the real path, Walk lists no files of a link
+			return filepath.Walk(real, walkFile(real))
+		}
+
+		err = walk(targetPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(importMap)
+
+	var importSlice []string
+	for targetImport := range files {
+		importSlice = append(importSlice, targetImport)
+	}
+
+	for _, targetImport := range importSlice {
+		var paths []string
+		for targetPath := range files[targetImport] {
+			paths = append(paths, targetPath)
+		}
+		sort.Strings(paths)
+		result[targetImport] = paths
+	}
+
+	return result, nil
+}
+
+// stdinPath is the name of the source read from stdin, given as -.
+const stdinPath = "<stdin>"
+
+// stdinSource is the source read from stdin.
+var stdinSource []byte
+
+// readSource returns the source of the file at path, or the source read
+// from stdin for stdinPath.
+func readSource(path string) ([]byte, error) {
+	if path == stdinPath {
+		return stdinSource, nil
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// parseFile parses the file at path like parser.ParseFile, path being
+// stdinPath for the source read from stdin.
+func parseFile(fset *token.FileSet, path string, mode parser.Mode) (*ast.File, error) {
+	src, err := readSource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.ParseFile(fset, path, src, mode)
+}
+
+// describeParseError formats err, quoting the source line of each syntax
+// error it holds with a caret under the offending column.
+func describeParseError(err error) string {
+	list, isList := err.(scanner.ErrorList)
+	if !isList {
+		return err.Error()
+	}
+
+	sources := make(map[string][]string)
+	var b strings.Builder
+	for i, e := range list {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(e.Error())
+
+		lines, read := sources[e.Pos.Filename]
+		if !read {
+			if src, err := readSource(e.Pos.Filename); err == nil {
+				lines = strings.Split(string(src), "\n")
+			}
+			sources[e.Pos.Filename] = lines
+		}
+		if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+			continue
+		}
+
+		line := lines[e.Pos.Line-1]
+		col := e.Pos.Column - 1
+		if col > len(line) {
+			col = len(line)
+		}
+		// keep tabs so the caret lines up however they're displayed
+		indent := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, line[:col])
+		fmt.Fprintf(&b, "\n\t%s\n\t%s^", line, indent)
 	}
 
-	if *version {
-		fmt.Println("scaneo version 1.2.0")
-		return
-	}
+	return b.String()
+}
 
-	if *packName == "current directory" {
-		wd, err := os.Getwd()
-		if err != nil {
-			log.Fatal("couldn't get working directory:", err)
+// aliasImports returns importmap with the target imports sharing a package
+// name, like example.com/a/models and example.com/b/models, renamed to
+// "alias path" entries, e.g. "amodels example.com/a/models". Generated code
+// imports them under their alias and qualifies their types with it.
+// Package names are those of the package clauses, which needn't be the last
+// element of the import path.
+func aliasImports(importmap importMap) importMap {
+	byName := make(map[string][]string)
+	taken := make(map[string]bool)
+	for targetImport, paths := range importmap {
+		if targetImport == "" {
+			continue
 		}
-
-		*packName = filepath.Base(wd)
+		name := packageName(targetImport, paths)
+		byName[name] = append(byName[name], targetImport)
+		taken[name] = true
 	}
 
-	importmap, err := findFiles(flag.Args())
-	if err != nil {
-		log.Println("couldn't find files:", err)
-		log.Fatal(usageText)
+	aliased := make(importMap, len(importmap))
+	for targetImport, paths := range importmap {
+		aliased[targetImport] = paths
 	}
+	for name, imports := range byName {
+		if len(imports) < 2 {
+			continue
+		}
 
-	structToks := make([]structToken, 0, 8)
-	for targetImport, targetPathSlice := range importmap {
-		for _, targetPath := range targetPathSlice {
-			toks, err := parseCode(targetImport, targetPath, *whitelist)
-			if err != nil {
-				log.Println(`"syntax error" - parser probably`)
-				log.Fatal(err)
-			}
+		sort.Strings(imports)
+		for _, targetImport := range imports {
+			alias := importAlias(targetImport, name, taken)
+			taken[alias] = true
 
-			structToks = append(structToks, toks...)
+			aliased[alias+" "+targetImport] = aliased[targetImport]
+			delete(aliased, targetImport)
 		}
 	}
 
-	if err := genFile(*outFilename, *packName, *unexport, structToks); err != nil {
-		log.Fatal("couldn't generate file:", err)
-	}
+	return aliased
 }
 
-func findFiles(paths []string) (importMap, error) {
-	if len(paths) < 1 {
-		return nil, errors.New("no starting paths")
+// packageName returns the name in the package clause of the first of paths,
+// or the one guessed from targetImport when it can't be read.
+func packageName(targetImport string, paths []string) string {
+	if len(paths) > 0 {
+		astf, err := parseFile(token.NewFileSet(), paths[0], parser.PackageClauseOnly)
+		if err == nil {
+			return astf.Name.Name
+		}
 	}
 
-	// using map to prevent duplicate file path entries
-	// in case the user accidently passes the same file path more than once
-	// probably because of autocomplete
-	files := make(map[string]map[string]bool)
+	return importName(targetImport)
+}
 
-	for _, target := range paths {
-		targetComponents := strings.Split(target, "=")
-		if len(targetComponents) != 2 {
-			return nil, fmt.Errorf("broken target, expected <golang_import_path=golang_source_package_or_file>, you provided: %s", target)
+// inferImport returns the import path of the package in dir, the path of
+// the module declared by the enclosing go.mod joined with dir relative to
+// it. It returns "" for directories outside modules.
+func inferImport(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for root := dir; ; root = filepath.Dir(root) {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			module, err := modulePath(filepath.Join(root, "go.mod"))
+			if err != nil {
+				return ""
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil || rel == "." {
+				return module
+			}
+			return module + "/" + filepath.ToSlash(rel)
 		}
-		targetImport, targetPath := targetComponents[0], targetComponents[1]
-		info, err := os.Stat(targetPath)
-		if err != nil {
-			return nil, err
+
+		if filepath.Dir(root) == root {
+			return ""
 		}
+	}
+}
 
-		if _, found := files[targetImport]; !found {
-			files[targetImport] = make(map[string]bool)
+// downloadPackage locates the package of target, path@version, in the
+// module cache, downloading its module with the go tool when needed. It
+// returns the import path and directory of the package. The module is the
+// one of the longest prefix of path the go tool knows a module of.
+func downloadPackage(target string) (string, string, error) {
+	i := strings.LastIndex(target, "@")
+	path, version := target[:i], target[i+1:]
+
+	var firstErr error
+	for module := path; ; {
+		dir, err := downloadModule(module, version)
+		if err == nil {
+			rel := strings.TrimPrefix(path, module)
+			return path, filepath.Join(dir, filepath.FromSlash(rel)), nil
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
 
-		if !info.IsDir() {
-			// add file path to files
-			files[targetImport][targetPath] = true
-			continue
+		i := strings.LastIndex(module, "/")
+		if i < 0 {
+			return "", "", fmt.Errorf("couldn't download %s: %v", target, firstErr)
 		}
+		module = module[:i]
+	}
+}
 
-		filepath.Walk(targetPath, func(fp string, fi os.FileInfo, _ error) error {
-			if fi.IsDir() {
-				// will still enter directory
-				return nil
-			} else if fi.Name()[0] == '.' {
-				return nil
-			}
+// downloadModule returns the directory of module at version in the module
+// cache, running go mod download.
+func downloadModule(module, version string) (string, error) {
+	cmd := exec.Command("go", "mod", "download", "-json", module+"@"+version)
+	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	out, err := cmd.Output()
 
-			// add file path to files
-			files[targetImport][fp] = true
-			return nil
-		})
+	var info struct {
+		Dir   string
+		Error string
+	}
+	if jsonErr := json.Unmarshal(out, &info); jsonErr != nil {
+		if err != nil {
+			return "", err
+		}
+		return "", jsonErr
+	}
+	if info.Error != "" {
+		return "", errors.New(info.Error)
+	}
+	if err != nil {
+		return "", err
 	}
 
-	result := make(importMap)
+	return info.Dir, nil
+}
 
-	var importSlice []string
-	for targetImport := range files {
-		importSlice = append(importSlice, targetImport)
+// generatedHeader matches the comment marking generated files, the Go
+// convention or the header of scaneo releases predating stamps.
+var generatedHeader = regexp.MustCompile(`^// (Code generated .* DO NOT EDIT\.|DON'T EDIT \*\*\* generated by scaneo \*\*\* DON'T EDIT //)$`)
+
+// isGenerated reports whether the file at path has a generated file comment
+// before its package clause.
+func isGenerated(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
 	}
+	defer f.Close()
 
-	for _, targetImport := range importSlice {
-		var paths []string
-		for targetPath := range files[targetImport] {
-			paths = append(paths, targetPath)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if generatedHeader.MatchString(line) {
+			return true
 		}
-		sort.Strings(paths)
-		result[targetImport] = paths
 	}
 
-	return result, nil
+	return false
 }
 
-func parseCode(targetImport string, source string, commaList string) ([]structToken, error) {
-	wlist := make(map[string]struct{})
-	if commaList != "" {
-		wSplits := strings.Split(commaList, ",")
-		for _, s := range wSplits {
-			wlist[s] = struct{}{}
-		}
+func parseCode(targetImport string, source string, opts *options) ([]structToken, error) {
+	filter, err := opts.structFilter()
+	if err != nil {
+		return nil, err
 	}
 
 	structToks := make([]structToken, 0, 8)
 
 	fset := token.NewFileSet()
-	astf, err := parser.ParseFile(fset, source, nil, 0)
+	astf, err := parseFile(fset, source, parser.ParseComments)
 	if err != nil {
 		return nil, err
 	}
 
-	var filter bool
-	if len(wlist) > 0 {
-		filter = true
+	// types of other packages are qualified by the name of their package
+	// clause, which needn't be the last element of their import path
+	var selectorExpr string
+	if targetImport != "" {
+		selectorExpr = astf.Name.Name
+		if i := strings.IndexByte(targetImport, ' '); i > 0 {
+			// the alias of an aliased import
+			selectorExpr = targetImport[:i]
+		}
 	}
 
-	var selectorExpr string
-	{
-		selectorList := strings.Split(targetImport, "/")
-		selectorExpr = selectorList[len(selectorList) - 1]
+	var cgo bool
+	imports := make([]string, 0, len(astf.Imports))
+	for _, imp := range astf.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if path == "C" {
+			// C types can't be referred to outside the file
+			cgo = true
+			continue
+		}
+		if imp.Name != nil && imp.Name.Name != "_" && imp.Name.Name != "." && imp.Name.Name != importName(path) {
+			// field types use the name, so the generated code imports
+			// the package under it too
+			path = imp.Name.Name + " " + path
+		}
+		imports = append(imports, path)
 	}
 
 	//ast.Print(fset, astf)
@@ -257,19 +2238,49 @@ func parseCode(targetImport string, source string, commaList string) ([]structTo
 
 			// found a struct in the source code!
 
+			doc := typeSpec.Doc
+			if doc == nil && len(genDecl.Specs) == 1 {
+				doc = genDecl.Doc
+			}
+			directives := parseDirectives(doc)
+
 			var structTok structToken
 			structTok.Import = targetImport
 			structTok.Selector = selectorExpr
+			structTok.Imports = imports
 			// filter logic
-			if structName := typeSpec.Name.Name; !filter {
-				// no filter, collect everything
-				structTok.Name = structName
-			} else if _, exists := wlist[structName]; filter && !exists {
-				// if structName not in whitelist, continue
+			structName := typeSpec.Name.Name
+			if !filter.match(structName) {
 				continue
-			} else if filter && exists {
-				// structName exists in whitelist
-				structTok.Name = structName
+			}
+			structTok.Name = structName
+
+			if typeSpec.TypeParams != nil {
+				// generated code would need type arguments to refer to it
+				log.Printf("%s: skipping generic struct %s", fset.Position(typeSpec.Pos()), structTok.Name)
+				continue
+			}
+
+			if _, ignore := directives["ignore"]; ignore && !filter.named(structName) {
+				// opted out, unless whitelisted by name
+				continue
+			}
+
+			_, structTok.OptIn = directives["generate"]
+			structTok.Table = directives["table"]
+			if structTok.Table == "" {
+				structTok.Table = snakeCase(structTok.Name)
+			}
+			if opts.Schema != "" && !strings.Contains(structTok.Table, ".") {
+				structTok.Table = opts.Schema + "." + structTok.Table
+			}
+
+			if timeout, exists := directives["timeout"]; exists {
+				timeouts, err := parseTimeouts(timeout)
+				if err != nil {
+					return nil, fmt.Errorf("struct %s: %s", structTok.Name, err)
+				}
+				structTok.Timeouts = timeouts
 			}
 
 			structTok.Fields = make([]fieldToken, 0, len(structType.Fields.List))
@@ -283,6 +2294,40 @@ func parseCode(targetImport string, source string, commaList string) ([]structTo
 					fieldToks[i].Name = parseIdent(fieldName)
 				}
 
+				if opts.ExportedOnly && len(fieldToks) > 0 {
+					exported := fieldToks[:0]
+					for _, fieldTok := range fieldToks {
+						if ast.IsExported(fieldTok.Name) {
+							exported = append(exported, fieldTok)
+						}
+					}
+					if len(exported) == 0 {
+						continue
+					}
+					fieldToks = exported
+				}
+
+				tagName, tagOpts := parseTag(fieldLine.Tag)
+				if tagName == "-" {
+					// explicitly not a column
+					for _, fieldTok := range fieldToks {
+						structTok.Skipped = append(structTok.Skipped, fieldTok.Name)
+					}
+					continue
+				}
+
+				if len(fieldLine.Names) == 0 {
+					// embedded struct, flattened in once every struct is parsed
+					ident, isIdent := fieldLine.Type.(*ast.Ident)
+					if !isIdent {
+						log.Printf("%s: skipping embedded %s, only structs of the same package are flattened",
+							fset.Position(fieldLine.Pos()), types.ExprString(fieldLine.Type))
+						continue
+					}
+					structTok.Fields = append(structTok.Fields, fieldToken{Name: ident.Name, Type: ident.Name, Embed: true})
+					continue
+				}
+
 				var fieldType string
 
 				// get field type
@@ -299,20 +2344,130 @@ func parseCode(targetImport string, source string, commaList string) ([]structTo
 				case *ast.StarExpr:
 					// pointers
 					fieldType = parseStar(typeToken)
+				case *ast.MapType:
+					// maps, e.g. hstore columns
+					fieldType = parseMap(typeToken)
+				}
+
+				// unsupported fields are skipped, or fail parsing with
+				// -strict-fields
+				unsupported := func(why string) error {
+					names := make([]string, len(fieldToks))
+					for i := range fieldToks {
+						names[i] = fieldToks[i].Name
+					}
+					err := fmt.Errorf("%s: struct %s: field %s has unsupported type %s%s", fset.Position(fieldLine.Pos()),
+						structTok.Name, strings.Join(names, ", "), types.ExprString(fieldLine.Type), why)
+					if opts.StrictFields {
+						return err
+					}
+					log.Printf("%s, skipping it", err)
+					return nil
 				}
 
 				if fieldType == "" {
+					// e.g. chan, func or interface types, skipping them
+					// shifts the columns scan functions expect
+					if err := unsupported(""); err != nil {
+						return nil, err
+					}
+					continue
+				}
+
+				if cgo && cType.MatchString(fieldType) {
+					log.Printf("%s: skipping field of C type %s", fset.Position(fieldLine.Pos()), fieldType)
+					continue
+				}
+
+				sqlType, ok := tagOpts["type"]
+				for opt, t := range tagTypes {
+					if _, exists := tagOpts[opt]; exists && !ok {
+						sqlType, ok = t, true
+					}
+				}
+				if !ok {
+					sqlType = opts.sqlType(fieldType)
+				}
+
+				strat, err := opts.strategy(sqlType)
+				if _, money := tagOpts["money"]; money {
+					strat, err = opts.moneyStrategy(fieldType, tagOpts["currency"])
+				}
+				if opts.Driver == "pgx" && isPgtype(fieldType) {
+					// pgx decodes into its own types, whatever the column type
+					strat, err = builtinStrategies["pgtype"], nil
+				}
+				if err != nil {
+					return nil, fmt.Errorf("struct %s: %s", structTok.Name, err)
+				}
+
+				_, extra := tagOpts["extra"]
+				if strings.HasPrefix(fieldType, "map[") && !extra && !opts.scansMap(fieldType, strat) {
+					if err := unsupported(" (only postgres hstore columns scan into map[string]string)"); err != nil {
+						return nil, err
+					}
 					continue
 				}
 
+				_, pk := tagOpts["pk"]
+
+				// types declared in the package are checked once resolved
+				declared := token.IsIdentifier(fieldType) && types.Universe.Lookup(fieldType) == nil
+				if _, version := tagOpts["version"]; version && !declared && !contains(integerTypes, fieldType) {
+					return nil, fmt.Errorf("struct %s: version field %s must be an integer, got %s",
+						structTok.Name, fieldToks[0].Name, fieldType)
+				}
+
 				// apply type to all variables declared in this line
 				for i := range fieldToks {
 					fieldToks[i].Type = fieldType
+					fieldToks[i].QualType = qualifyType(fieldType, selectorExpr)
+					fieldToks[i].Column = tagName
+					fieldToks[i].SQLType = sqlType
+					fieldToks[i].PK = pk
+					fieldToks[i].Opts = tagOpts
+					fieldToks[i].Strategy = strat
+
+					if tagName == "" && opts.Driver == "sqlx" {
+						// name columns like sqlx's default mapper
+						fieldToks[i].Column = strings.ToLower(fieldToks[i].Name)
+					} else if tagName == "" {
+						fieldToks[i].Column = snakeCase(fieldToks[i].Name)
+					}
+				}
+
+				if _, rank := tagOpts["rank"]; rank && len(fieldToks) == 1 {
+					// not a column, search helpers fill it in
+					structTok.Rank = &fieldToks[0]
+					continue
+				}
+
+				if _, extra := tagOpts["extra"]; extra && len(fieldToks) == 1 {
+					// not a column, name-based scan functions fill it in
+					if fieldType != "map[string]interface{}" && fieldType != "map[string]any" {
+						return nil, fmt.Errorf("struct %s: extra field %s must be a map[string]interface{}, got %s",
+							structTok.Name, fieldToks[0].Name, fieldType)
+					}
+					structTok.Extra = &fieldToks[0]
+					continue
 				}
 
 				structTok.Fields = append(structTok.Fields, fieldToks...)
 			}
 
+			if opts.ExportedOnly && len(structTok.Fields) == 0 {
+				log.Printf("%s: skipping struct %s, it has no exported fields", fset.Position(typeSpec.Pos()), structTok.Name)
+				continue
+			}
+
+			if !embeds(structTok) {
+				// embedding structs are checked once flattened
+				if err := checkCurrencyFields(structTok); err != nil {
+					return nil, fmt.Errorf("struct %s: %s", structTok.Name, err)
+				}
+			}
+
+			defaultPK(&structTok)
 			structToks = append(structToks, structTok)
 		}
 	}
@@ -320,6 +2475,204 @@ func parseCode(targetImport string, source string, commaList string) ([]structTo
 	return structToks, nil
 }
 
+// checkCurrencyFields checks that integer cents fields tagged money pair
+// with a string field of the struct holding their currency code.
+func checkCurrencyFields(st structToken) error {
+	types := make(map[string]string)
+	for _, f := range st.Fields {
+		types[f.Name] = f.Type
+	}
+
+	for _, f := range st.Fields {
+		if _, money := f.Opts["money"]; !money || f.Opts["currency"] == "" {
+			continue
+		}
+
+		switch strings.TrimPrefix(f.Type, "*") {
+		case "int", "int32", "int64":
+		default:
+			continue
+		}
+
+		code := f.Opts["currency"]
+		switch strings.TrimPrefix(types[code], "*") {
+		case "string":
+		case "":
+			return fmt.Errorf("money field %s pairs with currency field %s, which doesn't exist", f.Name, code)
+		default:
+			return fmt.Errorf("money field %s pairs with currency field %s, which must be a string, got %s", f.Name, code, types[code])
+		}
+	}
+
+	return nil
+}
+
+// defaultPK makes the id column the primary key of tok when no field is
+// tagged pk.
+func defaultPK(tok *structToken) {
+	if tok.PK() != nil {
+		return
+	}
+
+	for i := range tok.Fields {
+		if tok.Fields[i].Column == "id" {
+			tok.Fields[i].PK = true
+			return
+		}
+	}
+}
+
+// parseTag splits a `db:"name,opt,key=value"` struct tag into the column
+// name and its options.
+func parseTag(lit *ast.BasicLit) (string, map[string]string) {
+	tagOpts := make(map[string]string)
+	if lit == nil {
+		return "", tagOpts
+	}
+
+	raw, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", tagOpts
+	}
+
+	parts := strings.Split(reflect.StructTag(raw).Get("db"), ",")
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 {
+			tagOpts[kv[0]] = kv[1]
+		} else if opt != "" {
+			tagOpts[opt] = ""
+		}
+	}
+
+	return parts[0], tagOpts
+}
+
+// parseDirectives collects //scaneo:name args comments from a doc comment.
+func parseDirectives(doc *ast.CommentGroup) map[string]string {
+	directives := make(map[string]string)
+	if doc == nil {
+		return directives
+	}
+
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, "//scaneo:") {
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimPrefix(c.Text, "//scaneo:"), " ", 2)
+		if len(fields) == 2 {
+			directives[fields[0]] = strings.TrimSpace(fields[1])
+		} else {
+			directives[fields[0]] = ""
+		}
+	}
+
+	return directives
+}
+
+// parseTimeouts parses the arguments of a //scaneo:timeout directive,
+// either one duration for all query helpers, e.g. 2s, or durations per
+// class, e.g. read=2s write=10s.
+func parseTimeouts(args string) (map[string]string, error) {
+	timeouts := make(map[string]string)
+	for _, arg := range strings.Fields(args) {
+		class, timeout := "", arg
+		if i := strings.Index(arg, "="); i >= 0 {
+			class, timeout = arg[:i], arg[i+1:]
+		}
+
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q", timeout)
+		}
+
+		switch class {
+		case "":
+			timeouts["read"] = timeout
+			timeouts["write"] = timeout
+		case "read", "write":
+			timeouts[class] = timeout
+		default:
+			return nil, fmt.Errorf("unknown timeout class %q, expected read or write", class)
+		}
+	}
+
+	if len(timeouts) == 0 {
+		return nil, errors.New("timeout directive needs a duration")
+	}
+
+	return timeouts, nil
+}
+
+// snakeCase converts a Go identifier to a column or table name, e.g.
+// SemURL becomes sem_url.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := !unicode.IsUpper(runes[i-1]) && runes[i-1] != '_'
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				buf.WriteByte('_')
+			}
+		}
+		buf.WriteRune(unicode.ToLower(r))
+	}
+
+	return buf.String()
+}
+
+// lowerInitial lowercases the leading initialism or letter of a Go
+// identifier, e.g. ID becomes id and URLPath becomes urlPath.
+func lowerInitial(name string) string {
+	runes := []rune(name)
+
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+
+	if upper > 1 && upper < len(runes) {
+		// keep the first letter of the next word, e.g. the P in URLPath
+		upper--
+	}
+
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
+
+// upperInitial uppercases the first letter of name, e.g. models becomes
+// Models and élan becomes Élan.
+func upperInitial(name string) string {
+	if name == "" {
+		return name
+	}
+
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// qualifyType prefixes type names declared in the source package with its
+// selector, e.g. []Email becomes []models.Email.
+func qualifyType(fieldType, selector string) string {
+	if selector == "" {
+		return fieldType
+	}
+
+	base := strings.TrimLeft(fieldType, "[]*")
+	if strings.Contains(base, ".") || types.Universe.Lookup(base) != nil {
+		return fieldType
+	}
+
+	prefix := fieldType[:len(fieldType)-len(base)]
+	return prefix + selector + "." + base
+}
+
 func parseIdent(fieldType *ast.Ident) string {
 	// return like byte, string, int
 	return fieldType.Name
@@ -355,6 +2708,32 @@ func parseArray(fieldType *ast.ArrayType) string {
 	return fmt.Sprintf("[]%s", arrayType)
 }
 
+func parseMap(fieldType *ast.MapType) string {
+	// return like map[string]string, map[string]*string
+	var types [2]string
+
+	for i, expr := range []ast.Expr{fieldType.Key, fieldType.Value} {
+		switch typeToken := expr.(type) {
+		case *ast.Ident:
+			types[i] = parseIdent(typeToken)
+		case *ast.SelectorExpr:
+			types[i] = parseSelector(typeToken)
+		case *ast.StarExpr:
+			types[i] = parseStar(typeToken)
+		case *ast.InterfaceType:
+			if len(typeToken.Methods.List) == 0 {
+				types[i] = "interface{}"
+			}
+		}
+
+		if types[i] == "" {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("map[%s]%s", types[0], types[1])
+}
+
 func parseStar(fieldType *ast.StarExpr) string {
 	// return like *bool, *time.Time, *[]byte, and other array stuff
 	var starType string
@@ -374,58 +2753,3 @@ func parseStar(fieldType *ast.StarExpr) string {
 
 	return fmt.Sprintf("*%s", starType)
 }
-
-func genFile(outFile, pkg string, unexport bool, toks []structToken) error {
-	if len(toks) < 1 {
-		return errors.New("no structs found")
-	}
-
-	fout, err := os.Create(outFile)
-	if err != nil {
-		return err
-	}
-	defer fout.Close()
-
-	importSet := make(map[string]bool)
-	for _, tok := range toks {
-		importSet[tok.Import] = true
-	}
-
-	var importList []string
-	for targetImport := range importSet {
-		if targetImport == "" {
-			continue
-		}
-		importList = append(importList, targetImport)
-	}
-	sort.Strings(importList)
-
-	data := struct {
-		PackageName string
-		Import      []string
-		Tokens      []structToken
-		Visibility  string
-	}{
-		PackageName: pkg,
-		Import:      importList,
-		Visibility:  "S",
-		Tokens:      toks,
-	}
-
-	if unexport {
-		// func name will be scanFoo instead of ScanFoo
-		data.Visibility = "s"
-	}
-
-	fnMap := template.FuncMap{"title": strings.Title}
-	scansTmpl, err := template.New("scans").Funcs(fnMap).Parse(scansText)
-	if err != nil {
-		return err
-	}
-
-	if err := scansTmpl.Execute(fout, data); err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,188 @@
+// Package scaneo is the runtime support of code generated by the scaneo
+// command. It's only needed by programs that use it directly.
+package scaneo
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// columns caches the column to field index mapping of struct types.
+var columns sync.Map
+
+// ScanInto scans the current row of rows into the struct dst points to,
+// matching columns to fields by name. Columns are named the way scaneo
+// names them: after the db tag of a field, or else its name in snake case.
+// Fields of embedded structs count as fields of dst, and struct fields
+// tagged prefix as their prefixed columns.
+// It's slower than generated scan functions, but works with any struct,
+// so generated code can be adopted one struct at a time.
+func ScanInto(rows *sql.Rows, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("scaneo: ScanInto needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	fields := fieldsOf(v.Type())
+	dests := make([]interface{}, len(cols))
+	for i, col := range cols {
+		index, exists := fields[col]
+		if !exists {
+			return fmt.Errorf("scaneo: %s has no field for column %q", v.Type(), col)
+		}
+
+		dests[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+
+	return rows.Scan(dests...)
+}
+
+// fieldsOf maps the columns of struct type t to the index of their field.
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, cached := columns.Load(t); cached {
+		return fields.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	addFields(fields, t, nil, "")
+	columns.Store(t, fields)
+	return fields
+}
+
+// addFields adds the columns of struct type t to fields, prefixed with
+// prefix, under the index of their field within the field at index. Struct
+// fields tagged prefix add the columns of their struct, prefixed in turn.
+func addFields(fields map[string][]int, t reflect.Type, index []int, prefix string) {
+	for _, f := range structFields(t) {
+		if f.PkgPath != "" {
+			// unexported, can't be set
+			continue
+		}
+
+		opts := strings.Split(f.Tag.Get("db"), ",")
+		name := opts[0]
+		if name == "-" || hasOpt(opts[1:], "rank") || hasOpt(opts[1:], "extra") {
+			// not a column
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+
+		fieldIndex := append(append([]int{}, index...), f.Index...)
+		if nested, isNested := prefixOpt(opts[1:]); isNested && f.Type.Kind() == reflect.Struct {
+			if nested == "" {
+				// db:"address,prefix" prefixes with the column, address_
+				nested = name + "_"
+			}
+			addFields(fields, f.Type, fieldIndex, prefix+nested)
+			continue
+		}
+
+		fields[prefix+name] = fieldIndex
+	}
+}
+
+// structFields lists the fields of struct type t with those of its embedded
+// structs flattened in where they are embedded, like the scaneo command
+// does. Fields of t shadow embedded fields of the same name, and embedded
+// fields that clash are dropped, as Go selectors can't reach them either.
+// Embedded pointers and structs of other packages are skipped.
+func structFields(t reflect.Type) []reflect.StructField {
+	direct := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); !f.Anonymous {
+			direct[f.Name] = true
+		}
+	}
+
+	var fields []reflect.StructField
+	// position of promoted fields in fields, -1 once another clashes
+	promoted := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.Anonymous {
+			fields = append(fields, f)
+			continue
+		}
+		if strings.Split(f.Tag.Get("db"), ",")[0] == "-" ||
+			f.Type.Kind() != reflect.Struct || f.Type.PkgPath() != t.PkgPath() {
+			continue
+		}
+
+		for _, sub := range structFields(f.Type) {
+			if direct[sub.Name] {
+				continue
+			}
+			if _, clash := promoted[sub.Name]; clash {
+				promoted[sub.Name] = -1
+				continue
+			}
+
+			sub.Index = append([]int{i}, sub.Index...)
+			promoted[sub.Name] = len(fields)
+			fields = append(fields, sub)
+		}
+	}
+
+	flat := fields[:0]
+	for _, f := range fields {
+		if pos, isPromoted := promoted[f.Name]; !isPromoted || pos >= 0 {
+			flat = append(flat, f)
+		}
+	}
+
+	return flat
+}
+
+// prefixOpt returns the prefix of a prefix or prefix=value option.
+func prefixOpt(opts []string) (string, bool) {
+	for _, o := range opts {
+		if o == "prefix" || strings.HasPrefix(o, "prefix=") {
+			return strings.TrimPrefix(strings.TrimPrefix(o, "prefix"), "="), true
+		}
+	}
+
+	return "", false
+}
+
+func hasOpt(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// snakeCase converts a Go identifier to a column name, e.g. SemURL becomes
+// sem_url. It matches the conversion of the scaneo command.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := !unicode.IsUpper(runes[i-1]) && runes[i-1] != '_'
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				buf.WriteByte('_')
+			}
+		}
+		buf.WriteRune(unicode.ToLower(r))
+	}
+
+	return buf.String()
+}
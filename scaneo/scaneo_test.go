@@ -0,0 +1,84 @@
+package scaneo
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestFieldsOf(t *testing.T) {
+	type post struct {
+		ID      int
+		SemURL  string
+		Title   string  `db:"headline"`
+		Skip    string  `db:"-"`
+		Score   float64 `db:",rank"`
+		private string
+	}
+
+	expected := map[string][]int{
+		"id":       {0},
+		"sem_url":  {1},
+		"headline": {2},
+	}
+	if found := fieldsOf(reflect.TypeOf(post{})); !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected: %v; found: %v\n", expected, found)
+	}
+}
+
+type timestamps struct {
+	CreatedAt string
+	UpdatedAt string `db:"modified"`
+	Title     string
+}
+
+type audit struct {
+	UpdatedAt string
+	By        string
+}
+
+func TestFieldsOfEmbedded(t *testing.T) {
+	type post struct {
+		ID int
+		timestamps
+		audit
+		*sql.NullString
+		Title string
+	}
+
+	// Title shadows timestamps.Title, UpdatedAt clashes and is dropped,
+	// embedded pointers are skipped
+	expected := map[string][]int{
+		"id":         {0},
+		"created_at": {1, 0},
+		"by":         {2, 1},
+		"title":      {4},
+	}
+	if found := fieldsOf(reflect.TypeOf(post{})); !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected: %v; found: %v\n", expected, found)
+	}
+}
+
+type address struct {
+	Street string
+	City   string `db:"town"`
+}
+
+func TestFieldsOfPrefixed(t *testing.T) {
+	type user struct {
+		ID   int
+		Home address `db:"home,prefix=h_"`
+		Work address `db:"work,prefix"`
+	}
+
+	expected := map[string][]int{
+		"id":          {0},
+		"h_street":    {1, 0},
+		"h_town":      {1, 1},
+		"work_street": {2, 0},
+		"work_town":   {2, 1},
+	}
+	if found := fieldsOf(reflect.TypeOf(user{})); !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected: %v; found: %v\n", expected, found)
+	}
+}
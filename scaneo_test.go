@@ -1,13 +1,18 @@
 package main
 
 import (
+	"archive/zip"
 	"fmt"
 	"go/ast"
+	"go/importer"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -174,7 +179,7 @@ var (
 
 func TestFindFiles(t *testing.T) {
 	var noPaths []string
-	files, err := findFiles(noPaths)
+	_, err := findFiles(noPaths, &options{})
 	if err == nil {
 		t.Error("no file paths passed")
 		t.Error("should be error")
@@ -182,7 +187,7 @@ func TestFindFiles(t *testing.T) {
 	}
 
 	badPaths := []string{"doesnt/exist", "not/here.txt"}
-	files, err = findFiles(badPaths)
+	_, err = findFiles(badPaths, &options{})
 	if err == nil {
 		t.Error("passed non-existent file paths")
 		t.Error("should be error")
@@ -190,12 +195,14 @@ func TestFindFiles(t *testing.T) {
 	}
 
 	inputPaths := []string{"testdata/", testFiles[3]}
-	files, err = findFiles(inputPaths)
+	importmap, err := findFiles(inputPaths, &options{})
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
 
+	files := importmap[""]
+
 	if testFilesLen != len(files) {
 		t.Error("unexpected file count")
 		t.Errorf("expected: %d; found: %d\n", testFilesLen, len(files))
@@ -218,11 +225,538 @@ func TestFindFiles(t *testing.T) {
 	}
 }
 
+func TestFindFilesTrees(t *testing.T) {
+	tests := []struct {
+		files    map[string]string // by slash separated path
+		links    map[string]string // to paths of files
+		targets  []string          // $dir is the tree
+		opts     options
+		tags     []string
+		expected string // import paths and their files, e.g. example.com/models:post.go
+	}{
+		// import paths are inferred from go.mod, the generated package has none
+		// whatever import path it's given
+		{
+			files: map[string]string{
+				"go.mod":           "module example.com/app // the app\n\ngo 1.21\n",
+				"models/post.go":   "package models\n",
+				"models/v1/old.go": "package v1\n",
+				"store/store.go":   "package store\n",
+			},
+			targets:  []string{"$dir/models", "$dir/store", "example.com/other=$dir/store/store.go"},
+			opts:     options{Output: "$dir/store/scans.go"},
+			expected: ":store.go example.com/app/models/v1:old.go example.com/app/models:post.go",
+		},
+		// a leading = gives an empty import path, and later ones are in the source path
+		{
+			files:    map[string]string{"a=b/post.go": "package models\n"},
+			targets:  []string{"=$dir/a=b"},
+			expected: ":post.go",
+		},
+		{
+			files:    map[string]string{"a=b/post.go": "package models\n"},
+			targets:  []string{"example.com/models=$dir/a=b"},
+			expected: "example.com/models:post.go",
+		},
+		// tests, generated files and the output are skipped
+		{
+			files: map[string]string{
+				"post.go":      "package models\n\ntype Post struct {\n\tID int64\n}\n",
+				"post_test.go": "package models\n",
+				"post.pb.go":   "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage models\n",
+				"old.go":       "// DON'T EDIT *** generated by scaneo *** DON'T EDIT //\n\npackage models\n",
+				"scans.go":     "package models\n",
+			},
+			targets:  []string{"=$dir"},
+			opts:     options{Output: "$dir/scans.go"},
+			expected: ":post.go",
+		},
+		// files are matched against build tags
+		{
+			files: map[string]string{
+				"post.go":     "package models\n",
+				"postgres.go": "//go:build postgres\n\npackage models\n",
+				"mysql.go":    "//go:build mysql\n\npackage models\n",
+			},
+			targets:  []string{"=$dir"},
+			expected: ":post.go",
+		},
+		{
+			files: map[string]string{
+				"post.go":     "package models\n",
+				"postgres.go": "//go:build postgres\n\npackage models\n",
+				"mysql.go":    "//go:build mysql\n\npackage models\n",
+			},
+			targets:  []string{"=$dir"},
+			tags:     []string{"postgres"},
+			expected: ":post.go,postgres.go",
+		},
+		// directories are skipped by name, links are followed once
+		{
+			files: map[string]string{
+				"post.go":           "package models\n",
+				"vendor/lib/lib.go": "package lib\n",
+				"testdata/data.go":  "package models\n",
+				"shared/shared.go":  "package models\n",
+			},
+			targets:  []string{"$dir"},
+			expected: ":post.go,shared.go",
+		},
+		{
+			files: map[string]string{
+				"post.go":           "package models\n",
+				"vendor/lib/lib.go": "package lib\n",
+				"testdata/data.go":  "package models\n",
+				"shared/shared.go":  "package models\n",
+			},
+			targets:  []string{"$dir"},
+			opts:     options{SkipDirs: "none"},
+			expected: ":data.go,lib.go,post.go,shared.go",
+		},
+		{
+			files: map[string]string{
+				"post.go":          "package models\n",
+				"shared/shared.go": "package models\n",
+			},
+			links:    map[string]string{"linked": "shared", "shared/loop": "."},
+			targets:  []string{"$dir"},
+			opts:     options{SkipDirs: "shared", FollowSymlinks: true},
+			expected: ":post.go,shared.go",
+		},
+	}
+
+	defer func(tags []string) { buildContext.BuildTags = tags }(buildContext.BuildTags)
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "scaneo-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for name, code := range test.files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for name, target := range test.links {
+			if err := os.Symlink(filepath.Join(dir, filepath.FromSlash(target)), filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				t.Skip(err)
+			}
+		}
+
+		var targets []string
+		for _, target := range test.targets {
+			targets = append(targets, strings.Replace(target, "$dir", dir, -1))
+		}
+		test.opts.Output = strings.Replace(test.opts.Output, "$dir", dir, -1)
+		buildContext.BuildTags = test.tags
+
+		importmap, err := findFiles(targets, &test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []string
+		for targetImport, paths := range importmap {
+			var names []string
+			for _, path := range paths {
+				names = append(names, filepath.Base(path))
+			}
+			sort.Strings(names)
+			found = append(found, targetImport+":"+strings.Join(names, ","))
+		}
+		sort.Strings(found)
+		if strings.Join(found, " ") != test.expected {
+			t.Errorf("%v: expected: %s; found: %s\n", test.targets, test.expected, strings.Join(found, " "))
+		}
+	}
+}
+
+func TestPackageClauseSelector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the package in db is called models, which its import path doesn't tell
+	src := filepath.Join(dir, "post.go")
+	if err := ioutil.WriteFile(src, []byte(stubPackages["example.com/app/db"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	toks, err := parseCode("example.com/app/db", src, &options{Dialect: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{Output: filepath.Join(dir, "scans.go"), Package: "store", Dialect: "postgres", Funcs: "get"}
+	if _, err := genFile(opts, toks, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`models "example.com/app/db"`, "(models.Post, error)"} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, out)
+		}
+	}
+	if err := checkTypes(opts.Output); err != nil {
+		t.Errorf("generated code doesn't type-check: %s\n%s", err, out)
+	}
+}
+
+func TestFindFilesImportPaths(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "models")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"post.go", "post_test.go", filepath.Join("sub", "sub.go")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("package models\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(gopath string) { buildContext.GOPATH = gopath }(buildContext.GOPATH)
+	buildContext.GOPATH = gopath
+
+	importmap, err := findFiles([]string{"example.com/models"}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := importmap["example.com/models"]; len(found) != 1 || found[0] != filepath.Join(dir, "post.go") {
+		t.Errorf("expected %s; found: %v\n", filepath.Join(dir, "post.go"), importmap)
+	}
+
+	if _, err := findFiles([]string{"example.com/missing"}, &options{}); err == nil {
+		t.Error("expected an error for a missing package")
+	}
+}
+
+func TestFindFilesModuleVersions(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a file proxy serving example.com/contracts v1.4.0
+	proxy := filepath.Join(tmp, "proxy", "example.com", "contracts", "@v")
+	if err := os.MkdirAll(proxy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"v1.4.0.info": `{"Version":"v1.4.0"}`,
+		"v1.4.0.mod":  "module example.com/contracts\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(proxy, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zf, err := os.Create(filepath.Join(proxy, "v1.4.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	for name, content := range map[string]string{
+		"go.mod":           "module example.com/contracts\n",
+		"models/models.go": "package models\n\ntype Contract struct {\n\tID int64\n}\n",
+	} {
+		w, err := zw.Create("example.com/contracts@v1.4.0/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zf.Close()
+
+	env := map[string]string{
+		"GOPROXY":    "file://" + filepath.ToSlash(filepath.Join(tmp, "proxy")),
+		"GOMODCACHE": filepath.Join(tmp, "modcache"),
+		"GOFLAGS":    "-modcacherw",
+		"GONOSUMDB":  "example.com",
+		"GOSUMDB":    "off",
+	}
+	for name, value := range env {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	importmap, err := findFiles([]string{"example.com/contracts/models@v1.4.0"}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := importmap["example.com/contracts/models"]
+	if len(found) != 1 || filepath.Base(found[0]) != "models.go" {
+		t.Errorf("expected models.go of example.com/contracts/models; found: %v\n", importmap)
+	}
+
+	if _, err := findFiles([]string{"example.com/contracts/models@v9.9.9"}, &options{}); err == nil {
+		t.Error("expected an error for a missing version")
+	}
+}
+
+func TestFindFilesStdin(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(src, []byte("package models\n\ntype Post struct {\n\tID int64\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	stdin, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+
+	importmap, err := findFiles([]string{"-"}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := importmap[""]; len(found) != 1 || found[0] != stdinPath {
+		t.Fatalf("expected %s; found: %v\n", stdinPath, importmap)
+	}
+
+	toks, err := parseCode("", stdinPath, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toks) != 1 || toks[0].Name != "Post" {
+		t.Errorf("expected struct Post from stdin; found: %v\n", toks)
+	}
+}
+
+func TestAliasImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the package in db is called models too, which its import path doesn't tell
+	files := map[string]string{
+		"db/post.go":     stubPackages["example.com/app/db"],
+		"models/user.go": stubPackages["example.com/b/models"],
+		"users/user.go":  "package users\n",
+		"store/store.go": "package store\n",
+	}
+	for name, code := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	importmap := aliasImports(importMap{
+		"":                     {filepath.Join(dir, "store", "store.go")},
+		"example.com/app/db":   {filepath.Join(dir, "db", "post.go")},
+		"example.com/b/models": {filepath.Join(dir, "models", "user.go")},
+		"example.com/users":    {filepath.Join(dir, "users", "user.go")},
+	})
+
+	var imports []string
+	for targetImport := range importmap {
+		imports = append(imports, targetImport)
+	}
+	sort.Strings(imports)
+	expected := ",appmodels example.com/app/db,bmodels example.com/b/models,example.com/users"
+	if found := strings.Join(imports, ","); found != expected {
+		t.Errorf("expected: %s; found: %s\n", expected, found)
+	}
+
+	opts := &options{Output: filepath.Join(dir, "store", "scans.go"), Package: "store", Dialect: "postgres", Funcs: "get"}
+	var toks []structToken
+	for _, targetImport := range []string{"appmodels example.com/app/db", "bmodels example.com/b/models"} {
+		found, err := parseCode(targetImport, importmap[targetImport][0], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks = append(toks, found...)
+	}
+	if _, err := genFile(opts, toks, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`appmodels "example.com/app/db"`, `bmodels "example.com/b/models"`, "(appmodels.Post, error)", "(bmodels.User, error)"} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, out)
+		}
+	}
+	if err := checkTypes(opts.Output); err != nil {
+		t.Errorf("generated code doesn't type-check: %s\n%s", err, out)
+	}
+}
+
+func TestResolveNameCollisions(t *testing.T) {
+	toks := []structToken{
+		{Name: "Post"},
+		{Import: "example.com/models", Selector: "models", Name: "Post"},
+		{Import: "example.com/models", Selector: "models", Name: "User"},
+	}
+
+	err := resolveNameCollisions(toks, &options{})
+	if err == nil || !strings.Contains(err.Error(), "the generated package and example.com/models") {
+		t.Errorf("expected an error naming both packages; found: %v\n", err)
+	}
+
+	if err := resolveNameCollisions(toks, &options{QualifyNames: true}); err != nil {
+		t.Fatal(err)
+	}
+	var names, types []string
+	for _, tok := range toks {
+		names = append(names, tok.Name)
+		types = append(types, tok.TypeName())
+	}
+	if found := strings.Join(names, ","); found != "Post,ModelsPost,User" {
+		t.Errorf("expected names Post,ModelsPost,User; found: %s\n", found)
+	}
+	if found := strings.Join(types, ","); found != "Post,models.Post,models.User" {
+		t.Errorf("expected types Post,models.Post,models.User; found: %s\n", found)
+	}
+}
+
+func TestStdoutOutput(t *testing.T) {
+	out, err := ioutil.TempFile("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	os.Stdout = out
+
+	if err := writeOutput("-", []byte("package models\n")); err != nil {
+		t.Fatal(err)
+	}
+	if src, err := ioutil.ReadFile(out.Name()); err != nil || string(src) != "package models\n" {
+		t.Errorf("expected the generated code on stdout; found: %q, %v\n", src, err)
+	}
+
+	opts := &options{Output: "-", Driver: "database/sql", Layout: "single", UnknownColumns: "error", BatchSize: 500}
+	if err := opts.check(); err != nil {
+		t.Error(err)
+	}
+	opts.Layout = "split"
+	if err := opts.check(); err == nil {
+		t.Error("expected an error for a split layout on stdout")
+	}
+}
+
+func TestFindFilesSkips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"post.go":      "package models\n\ntype Post struct {\n\tID int64\n}\n",
+		"post_test.go": "package models\n",
+		"post.pb.go":   "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage models\n",
+		"old.go":       "// DON'T EDIT *** generated by scaneo *** DON'T EDIT //\n\npackage models\n",
+		"scans.go":     "package models\n",
+	}
+	for name, code := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	importmap, err := findFiles([]string{"=" + dir}, &options{Output: filepath.Join(dir, "scans.go")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := importmap[""]; len(found) != 1 || filepath.Base(found[0]) != "post.go" {
+		t.Errorf("expected only post.go; found: %v\n", found)
+	}
+}
+
+func TestFindFilesUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads directories regardless of their permissions")
+	}
+
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "post.go"), []byte("package models\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	private := filepath.Join(dir, "private")
+	if err := os.Mkdir(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0755)
+
+	if _, err := findFiles([]string{"=" + dir}, &options{}); err == nil {
+		t.Error("expected an error for the unreadable directory")
+	}
+
+	importmap, err := findFiles([]string{"=" + dir}, &options{ContinueOnError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := importmap[""]; len(found) != 1 || filepath.Base(found[0]) != "post.go" {
+		t.Errorf("expected the unreadable directory to be skipped; found: %v\n", found)
+	}
+}
+
+func TestDescribeParseError(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\ntype Post struct {\n\tID int64 Title string\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	_, err := parseCode("", src, &options{})
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	found := describeParseError(err)
+	if !strings.HasPrefix(found, src+":4:11: ") {
+		t.Errorf("expected the file, line and column of the error; found: %q\n", found)
+	}
+	if snippet := "\n\t\tID int64 Title string\n\t\t         ^"; !strings.Contains(found, snippet) {
+		t.Errorf("expected the offending line %q; found: %q\n", snippet, found)
+	}
+}
+
 func TestWhitelist(t *testing.T) {
-	whitelist := "Exported,unexported"
+	opts := &options{Whitelist: "Exported,unexported"}
 	expectedToks := 2
 
-	toks, err := parseCode(testFiles[3], whitelist)
+	toks, err := parseCode("", testFiles[3], opts)
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
@@ -234,11 +768,150 @@ func TestWhitelist(t *testing.T) {
 	}
 }
 
+func TestWhitelistPatterns(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\ntype PostRow struct {\n\tID int64\n}\n\n" +
+		"type DBUser struct {\n\tID int64\n}\n\n" +
+		"//scaneo:ignore\ntype PageRow struct {\n\tNext string\n}\n\n" +
+		"type Config struct {\n\tName string\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	tests := []struct {
+		opts     options
+		expected string
+	}{
+		{options{Whitelist: "*Row"}, "PostRow"},
+		{options{Whitelist: "*Row,PageRow"}, "PostRow,PageRow"},
+		{options{WhitelistRegex: "^DB"}, "DBUser"},
+		{options{Whitelist: "Config", WhitelistRegex: "^DB"}, "DBUser,Config"},
+		{options{Exclude: "Config"}, "PostRow,DBUser"},
+		{options{Whitelist: "*Row,PageRow", Exclude: "Post*"}, "PageRow"},
+	}
+	for _, test := range tests {
+		toks, err := parseCode("", src, &test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, tok := range toks {
+			names = append(names, tok.Name)
+		}
+		if found := strings.Join(names, ","); found != test.expected {
+			t.Errorf("-w %q -w-regex %q -x %q: expected: %s; found: %s\n", test.opts.Whitelist, test.opts.WhitelistRegex, test.opts.Exclude, test.expected, found)
+		}
+	}
+
+	opts := &options{Whitelist: "PostRow,*Record,Post", WhitelistRegex: "^Row"}
+	filter, err := opts.structFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	toks, err := parseCode("", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unmatched := strings.Join(filter.unmatched(toks), ","); unmatched != "*Record,Post,^Row" {
+		t.Errorf("expected unmatched entries *Record,Post,^Row; found: %s\n", unmatched)
+	}
+
+	if _, err := parseCode("", src, &options{Whitelist: "[Row"}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+	if _, err := parseCode("", src, &options{WhitelistRegex: "(DB"}); err == nil {
+		t.Error("expected an error for a malformed regex")
+	}
+}
+
+func TestExportedOnly(t *testing.T) {
+	toks, err := parseCode("", testFiles[3], &options{ExportedOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tok := range toks {
+		for _, f := range tok.Fields {
+			if !ast.IsExported(f.Name) {
+				t.Errorf("%s: expected unexported field %s to be skipped\n", tok.Name, f.Name)
+			}
+		}
+	}
+	if len(toks) != 2 || toks[0].Name != "Exported" || toks[1].Name != "unAndEx" {
+		t.Errorf("expected structs without exported fields to be skipped; found: %v\n", toks)
+	}
+}
+
+func TestOptedIn(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\n//scaneo:generate\ntype Post struct {\n\tID int64\n}\n\n" +
+		"type Page struct {\n\tNext string\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chosen := optedIn(toks); len(chosen) != 1 || chosen[0].Name != "Post" {
+		t.Errorf("expected only Post to opt in; found: %v\n", chosen)
+	}
+
+	if chosen := optedIn(toks[1:]); len(chosen) != 1 || chosen[0].Name != "Page" {
+		t.Errorf("expected every struct without opt-ins; found: %v\n", chosen)
+	}
+}
+
+func TestIgnoreDirective(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\ntype Post struct {\n\tID int64\n}\n\n" +
+		"//scaneo:ignore\ntype Page struct {\n\tNext string\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toks) != 1 || toks[0].Name != "Post" {
+		t.Errorf("expected Page to be ignored; found: %v\n", toks)
+	}
+
+	toks, err = parseCode("", src, &options{Whitelist: "Page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toks) != 1 || toks[0].Name != "Page" {
+		t.Errorf("expected the whitelist to include Page; found: %v\n", toks)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	opts := &options{Schema: "analytics"}
+
+	toks, err := parseCode("", testFiles[3], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tok := range toks {
+		if !strings.HasPrefix(tok.Table, "analytics.") {
+			t.Errorf("%s: expected table in analytics schema; found: %s\n", tok.Name, tok.Table)
+		}
+	}
+}
+
 func TestParseCode(t *testing.T) {
-	var noFilter string
+	noFilter := &options{}
 
 	var noSource string
-	if _, err := parseCode(noSource, noFilter); err == nil {
+	if _, err := parseCode("", noSource, noFilter); err == nil {
 		t.Error("no source file path passed")
 		t.Error("should be error")
 		t.FailNow()
@@ -246,7 +919,7 @@ func TestParseCode(t *testing.T) {
 
 	for fPath, structToks := range fileStructsMap {
 		// get all struct tokens for a given file
-		toks, err := parseCode(fPath, noFilter)
+		toks, err := parseCode("", fPath, noFilter)
 		if err != nil {
 			t.Error(err)
 			t.FailNow()
@@ -303,28 +976,31 @@ func TestGenFile(t *testing.T) {
 
 	expectedFuncNames := []string{
 		"scanExported",
+		"scanExportedInto",
 		"scanExporteds",
 		"scanUnexported",
+		"scanUnexportedInto",
 		"scanUnexporteds",
 	}
 
 	outFile := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d", time.Now().UnixNano()))
 
+	opts := &options{Output: outFile, Package: "testing", Unexport: true}
+
 	var noToks []structToken
-	if err := genFile(outFile, "testing", true, noToks); err == nil {
+	if _, err := genFile(opts, noToks, nil); err == nil {
 		t.Error("no struct tokens passed")
 		t.Error("should be error")
 		t.FailNow()
 	}
-	var noOutFile string
-	if err := genFile(noOutFile, "testing", true, toks); err == nil {
+	noOutFile := &options{Package: "testing", Unexport: true}
+	if _, err := genFile(noOutFile, toks, nil); err == nil {
 		t.Error("no output file path passed")
 		t.Error("should be error")
 		t.FailNow()
 	}
 
-	// genFile(file, package, unexport, tokens)
-	if err := genFile(outFile, "testing", true, toks); err != nil {
+	if _, err := genFile(opts, toks, nil); err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
@@ -347,9 +1023,9 @@ func TestGenFile(t *testing.T) {
 		scanFuncs = append(scanFuncs, funcDecl.Name.String())
 	}
 
-	if len(toks)*2 != len(scanFuncs) {
+	if len(toks)*3 != len(scanFuncs) {
 		t.Error("unexpected number of scan functions found")
-		t.Errorf("expected: %d; found: %d\n", len(toks)*2, len(scanFuncs))
+		t.Errorf("expected: %d; found: %d\n", len(toks)*3, len(scanFuncs))
 		t.FailNow()
 	}
 
@@ -361,3 +1037,2207 @@ func TestGenFile(t *testing.T) {
 	}
 
 }
+
+func TestGenFileDrivers(t *testing.T) {
+	toks := fileStructsMap[testFiles[3]][:1]
+	expectedFuncs := map[string][]string{
+		"spanner": {"exportedFromSpannerRow", "exportedsFromSpannerIter", "insertExportedMutation"},
+		"gocql":   {"scanExported", "scanExporteds", "exportedValues", "insertExported"},
+	}
+
+	for driver, expected := range expectedFuncs {
+		outFile := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d", time.Now().UnixNano()))
+		opts := &options{Output: outFile, Package: "testing", Unexport: true, Driver: driver}
+
+		if _, err := genFile(opts, toks, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(outFile)
+
+		astf, err := parser.ParseFile(token.NewFileSet(), outFile, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var funcs []string
+		for _, dec := range astf.Decls {
+			if funcDecl, isFuncDecl := dec.(*ast.FuncDecl); isFuncDecl {
+				funcs = append(funcs, funcDecl.Name.String())
+			}
+		}
+
+		if fmt.Sprint(funcs) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected: %v; found: %v\n", driver, expected, funcs)
+		}
+	}
+}
+
+func TestOtel(t *testing.T) {
+	toks := fileStructsMap[testFiles[3]][:1]
+	outFile := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d", time.Now().UnixNano()))
+	opts := &options{Output: outFile, Package: "testing", Dialect: "postgres", Funcs: "count,insert", Otel: true}
+
+	if _, err := genFile(opts, toks, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outFile)
+
+	src, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, span := range []string{`Tracer.Start(ctx, "Exported.count"`, `Tracer.Start(ctx, "Exported.insert"`} {
+		if !strings.Contains(string(src), span) {
+			t.Errorf("expected span %s\n", span)
+		}
+	}
+	if !strings.Contains(string(src), "(err error)") {
+		t.Error("expected named error results for spans to record")
+	}
+
+	// repositories query on their own rather than through the functions
+	tok := structToken{
+		Name:  "Item",
+		Table: "item",
+		Fields: []fieldToken{
+			{Name: "ID", Type: "int64", QualType: "int64", Column: "id", PK: true},
+			{Name: "Name", Type: "string", QualType: "string", Column: "name"},
+		},
+	}
+	opts = &options{Output: outFile, Package: "testing", Dialect: "postgres", Repo: true, Otel: true}
+	if _, err := genFile(opts, []structToken{tok}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if src, err = ioutil.ReadFile(outFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{"get", "list", "insert", "update", "delete"} {
+		if span := fmt.Sprintf(`Tracer.Start(ctx, "Item.%s"`, op); !strings.Contains(string(src), span) {
+			t.Errorf("expected repository span %s\n", span)
+		}
+	}
+}
+
+// stubPackages declare what generated code uses of the third party packages
+// it imports, so tests can type-check it offline.
+var stubPackages = map[string]string{
+	"github.com/paulmach/orb": `package orb
+
+type Point [2]float64
+
+type Ring []Point
+
+type Polygon []Ring
+`,
+	"github.com/paulmach/orb/encoding/wkb": `package wkb
+
+type GeometryScanner struct{}
+
+func (s *GeometryScanner) Scan(src interface{}) error { return nil }
+
+func Scanner(g interface{}) *GeometryScanner { return nil }
+`,
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver": `package driver
+
+type PrepareBatchOption func()
+
+type Batch interface {
+	Append(v ...interface{}) error
+	Abort() error
+	Send() error
+}
+`,
+	"github.com/lib/pq": `package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+func Array(a interface{}) interface {
+	driver.Valuer
+	sql.Scanner
+} {
+	return nil
+}
+`,
+	"github.com/example/driver": `package driver
+
+type ID int64
+`,
+	"example.com/b/models": `package models
+
+type Email string
+
+type User struct {
+	ID    int64
+	Email Email
+}
+`,
+	"example.com/app/db": `package models
+
+type Post struct {
+	ID    int64
+	Title string
+}
+`,
+	"go.opentelemetry.io/otel": `package otel
+
+import "go.opentelemetry.io/otel/trace"
+
+func Tracer(name string) trace.Tracer { return nil }
+`,
+	"go.opentelemetry.io/otel/attribute": `package attribute
+
+type KeyValue struct{}
+
+func Int(k string, v int) KeyValue { return KeyValue{} }
+
+func String(k, v string) KeyValue { return KeyValue{} }
+`,
+	"go.opentelemetry.io/otel/codes": `package codes
+
+type Code uint32
+
+const Error Code = 1
+`,
+	"go.opentelemetry.io/otel/trace": `package trace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type SpanStartOption interface{}
+
+func WithAttributes(attrs ...attribute.KeyValue) SpanStartOption { return nil }
+
+type Tracer interface {
+	Start(ctx context.Context, name string, opts ...SpanStartOption) (context.Context, Span)
+}
+
+type Span interface {
+	End()
+	RecordError(err error)
+	SetStatus(code codes.Code, description string)
+	SetAttributes(kv ...attribute.KeyValue)
+}
+`,
+	"github.com/Masterminds/squirrel": `package squirrel
+
+type PlaceholderFormat interface {
+	ReplacePlaceholders(sql string) (string, error)
+}
+
+type dollarFormat struct{}
+
+func (dollarFormat) ReplacePlaceholders(sql string) (string, error) { return sql, nil }
+
+var (
+	Dollar = dollarFormat{}
+	AtP    = dollarFormat{}
+)
+
+type SelectBuilder struct{}
+
+func Select(columns ...string) SelectBuilder { return SelectBuilder{} }
+
+func (b SelectBuilder) From(from string) SelectBuilder { return b }
+
+func (b SelectBuilder) PlaceholderFormat(f PlaceholderFormat) SelectBuilder { return b }
+`,
+	"github.com/jackc/pgx/v5": `package pgx
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrNoRows = errors.New("no rows in result set")
+
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+type Rows interface {
+	Close()
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+type Identifier []string
+
+type CopyFromSource interface {
+	Next() bool
+	Values() ([]interface{}, error)
+	Err() error
+}
+
+type Batch struct{}
+
+func (b *Batch) Queue(query string, args ...interface{}) *QueuedQuery { return nil }
+
+type QueuedQuery struct{}
+
+func (q *QueuedQuery) Query(fn func(rows Rows) error) {}
+
+func (q *QueuedQuery) QueryRow(fn func(row Row) error) {}
+
+type CollectableRow interface {
+	Scan(dest ...interface{}) error
+}
+
+type Tx interface {
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) Row
+}
+`,
+	"github.com/jackc/pgx/v5/pgconn": `package pgconn
+
+type CommandTag struct{}
+
+func (t CommandTag) RowsAffected() int64 { return 0 }
+`,
+	"github.com/jackc/pgx/v5/pgtype": `package pgtype
+
+type Hstore map[string]*string
+
+type CompositeFields []interface{}
+`,
+	"github.com/Rhymond/go-money": `package money
+
+type Money struct{ amount int64 }
+
+func New(amount int64, code string) *Money { return &Money{amount} }
+
+func (m *Money) Amount() int64 { return m.amount }
+`,
+	"github.com/paulmach/orb/encoding/ewkb": `package ewkb
+
+type GeometryScanner struct{}
+
+func (s *GeometryScanner) Scan(src interface{}) error { return nil }
+
+func Scanner(g interface{}) *GeometryScanner { return nil }
+`,
+}
+
+// stubImporter imports the standard library from source and third party
+// packages from stubPackages.
+type stubImporter struct {
+	std      types.Importer
+	packages map[string]*types.Package
+}
+
+func (imp *stubImporter) Import(path string) (*types.Package, error) {
+	code, isStub := stubPackages[path]
+	if !isStub {
+		return imp.std.Import(path)
+	}
+	if pkg, found := imp.packages[path]; found {
+		return pkg, nil
+	}
+
+	fset := token.NewFileSet()
+	astf, err := parser.ParseFile(fset, path, code, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := (&types.Config{Importer: imp}).Check(path, fset, []*ast.File{astf}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	imp.packages[path] = pkg
+	return pkg, nil
+}
+
+var stubs = &stubImporter{
+	std:      importer.ForCompiler(token.NewFileSet(), "source", nil),
+	packages: make(map[string]*types.Package),
+}
+
+// checkTypes type-checks the files at paths as one package.
+func checkTypes(paths ...string) error {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		astf, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, astf)
+	}
+
+	_, err := (&types.Config{Importer: stubs}).Check("models", fset, files, nil)
+	return err
+}
+
+// generate generates code with opts for the structs of code, a file of
+// package models, into the same package. It returns the generated code once
+// it type-checks along with code.
+func generate(t *testing.T, opts options, code string) string {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "models.go")
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	toks, err := parseCode("", src, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveComposites(toks, importMap{"": {src}}, &opts); err != nil {
+		t.Fatal(err)
+	}
+	pkgs := loadPackages(importMap{"": {src}})
+	resolveHooks(toks, pkgs)
+	resolveTypes(toks, pkgs)
+
+	var enums []enumToken
+	if opts.Enums {
+		if enums, err = parseEnums([]string{src}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts.Output, opts.Package = filepath.Join(dir, "scans.go"), "models"
+	if _, err := genFile(&opts, toks, enums); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkTypes(src, opts.Output); err != nil {
+		t.Fatalf("generated code doesn't type-check: %s\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestGeometry(t *testing.T) {
+	code := `package models
+
+import "github.com/paulmach/orb"
+
+type Place struct {
+	ID       int64
+	Location orb.Point
+	Area     orb.Polygon ` + "`db:\"area,type=geography\"`" + `
+}
+`
+	src := generate(t, options{Dialect: "postgres", Funcs: "get"}, code)
+	for _, expected := range []string{"wkb.Scanner(&s.Location)", "wkb.Scanner(&s.Area)", "SELECT id, ST_AsBinary(location) AS location, ST_AsBinary(area) AS area FROM place"} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected %s\n", expected)
+		}
+	}
+
+	opts := options{Dialect: "postgres", Funcs: "get", Types: map[string]typeMap{
+		"postgres": {SQL: map[string]string{"geography": "ewkb"}},
+	}}
+	src = generate(t, opts, code)
+	for _, expected := range []string{"wkb.Scanner(&s.Location)", "ewkb.Scanner(&s.Area)", "ST_AsEWKB(area)"} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected %s with geography as ewkb\n", expected)
+		}
+	}
+}
+
+func TestUpsertSQL(t *testing.T) {
+	tok := structToken{
+		Table: "tag",
+		Fields: []fieldToken{
+			{Name: "ID", Column: "id", PK: true},
+			{Name: "Label", Column: "label"},
+		},
+	}
+	keyOnly := structToken{Table: "tag", Fields: tok.Fields[:1]}
+
+	tests := []struct {
+		dialect  string
+		tok      structToken
+		expected string
+	}{
+		{"postgres", tok, "INSERT INTO tag (id, label) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET label = EXCLUDED.label"},
+		{"sqlite", tok, "INSERT INTO tag (id, label) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET label = EXCLUDED.label"},
+		{"mysql", tok, "INSERT INTO tag (id, label) VALUES (?, ?) ON DUPLICATE KEY UPDATE label = VALUES(label)"},
+		{"postgres", keyOnly, "INSERT INTO tag (id) VALUES ($1) ON CONFLICT (id) DO NOTHING"},
+		{"mysql", keyOnly, "INSERT INTO tag (id) VALUES (?) ON DUPLICATE KEY UPDATE id = id"},
+	}
+	for _, test := range tests {
+		if found := dialects[test.dialect].upsertSQL(test.tok); found != test.expected {
+			t.Errorf("%s: expected: %s; found: %s\n", test.dialect, test.expected, found)
+		}
+	}
+
+	code := "package models\n\ntype Tag struct {\n\tID    int64\n\tLabel string\n}\n"
+	if src := generate(t, options{Dialect: "mysql", Funcs: "upsert"}, code); !strings.Contains(src, "func UpsertTag(") {
+		t.Errorf("expected UpsertTag:\n%s\n", src)
+	}
+}
+
+func TestHstoreAndComposites(t *testing.T) {
+	code := `package models
+
+type Address struct {
+	Street string
+	City   string
+}
+
+type Shop struct {
+	ID    int64
+	Attrs map[string]string
+	Tags  map[string]string ` + "`db:\"tags,hstore\"`" + `
+	Addr  Address           ` + "`db:\"addr,composite\"`" + `
+}
+`
+	src := generate(t, options{Dialect: "postgres", Funcs: "upsert"}, code)
+	for _, expected := range []string{
+		"var t1 pgtype.Hstore", "s.Attrs = hstoreToMap(t1)", "mapToHstore(x.Tags)",
+		"pgtype.CompositeFields{&s.Addr.Street, &s.Addr.City}", "pgtype.CompositeFields{x.Addr.Street, x.Addr.City}",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected %s\n", expected)
+		}
+	}
+
+	// hstore is postgres only, maps are skipped elsewhere
+	src = generate(t, options{Dialect: "mysql", Funcs: "upsert"}, code)
+	if strings.Contains(src, "Hstore") {
+		t.Errorf("expected no hstore on mysql; found:\n%s\n", src)
+	}
+}
+
+func TestBatchInsert(t *testing.T) {
+	code := "package models\n\ntype Tag struct {\n\tID    int64\n\tLabel string\n}\n"
+	for _, dialect := range []string{"postgres", "mysql", "sqlite"} {
+		src := generate(t, options{Dialect: dialect, Funcs: "batch", BatchSize: 100}, code)
+		if !strings.Contains(src, "func InsertTagBatch(") || !strings.Contains(src, "const rowsPerInsert = 100") {
+			t.Errorf("%s: expected InsertTagBatch inserting 100 rows at a time:\n%s\n", dialect, src)
+		}
+	}
+}
+
+func TestMoney(t *testing.T) {
+	money := moneyType{
+		Type:      "money.Money",
+		Imports:   []string{"github.com/Rhymond/go-money"},
+		FromCents: "*money.New(%[1]s, %[2]q)",
+		ToCents:   "%s.Amount()",
+		Currency:  "USD",
+	}
+	code := `package models
+
+import "github.com/Rhymond/go-money"
+
+type Order struct {
+	ID            int64
+	Total         money.Money  ` + "`db:\"total_cents,money\"`" + `
+	Tip           *money.Money ` + "`db:\"tip_cents,money,currency=EUR\"`" + `
+	FeeCents      *int64       ` + "`db:\"fee_cents,money,currency=FeeCurrency\"`" + `
+	FeeCurrency   string
+}
+`
+	src := generate(t, options{Money: money, Funcs: "upsert"}, code)
+	for _, expected := range []string{
+		`s.Total = *money.New(t1, "USD")`,
+		`m := *money.New(*t2, "EUR")`,
+		`c := int64((*x.Tip).Amount())`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	tests := []struct {
+		field string
+		err   string
+	}{
+		{"Total float64 `db:\"total,money\"`", "money can't be a floating point float64, use integer cents"},
+		{"Total string `db:\"total,money\"`", "money must be integer cents or money.Money, got string"},
+		{"TotalCents int64 `db:\"total,money,currency=Code\"`", "money field TotalCents pairs with currency field Code, which doesn't exist"},
+		{"TotalCents int64 `db:\"total,money,currency=Code\"`\n\tCode int", "money field TotalCents pairs with currency field Code, which must be a string, got int"},
+	}
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src = filepath.Join(dir, "models.go")
+	for _, test := range tests {
+		code := "package models\n\ntype Order struct {\n\t" + test.field + "\n}\n"
+		if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := parseCode("", src, &options{Money: money})
+		if err == nil || err.Error() != "struct Order: "+test.err {
+			t.Errorf("expected: %s; found: %v\n", test.err, err)
+		}
+	}
+}
+
+func TestFindCaseInsensitive(t *testing.T) {
+	code := "package models\n\ntype User struct {\n\tID    int64\n\tEmail string `db:\"email,citext\"`\n\tName  string `db:\"name,ci\"`\n}\n"
+	tests := []struct {
+		dialect string
+		email   string
+		name    string
+	}{
+		{"postgres", `" WHERE email = $1"`, `" WHERE LOWER(name) = LOWER($1)"`},
+		{"mysql", `" WHERE LOWER(email) = LOWER(?)"`, `" WHERE LOWER(name) = LOWER(?)"`},
+		{"sqlite", `" WHERE email = ? COLLATE NOCASE"`, `" WHERE name = ? COLLATE NOCASE"`},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Funcs: "find"}, code)
+		for _, expected := range []string{"func FindUsersByEmail(", "func FindUsersByName(", test.email, test.name} {
+			if !strings.Contains(src, expected) {
+				t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, expected, src)
+			}
+		}
+		if strings.Contains(src, "FindUsersByID") {
+			t.Errorf("%s: expected no FindUsersByID; found:\n%s\n", test.dialect, src)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string  `db:\"title,fts\"`\n\tBody  string  `db:\"body,fts\"`\n\tScore float64 `db:\",rank\"`\n}\n"
+	doc := "to_tsvector(coalesce(title, '') || ' ' || coalesce(body, ''))"
+	tests := []struct {
+		dialect  string
+		expected string
+	}{
+		{"postgres", `"SELECT id, title, body, ts_rank(` + doc + `, plainto_tsquery($1)) FROM post WHERE ` + doc + ` @@ plainto_tsquery($1) ORDER BY ts_rank(` + doc + `, plainto_tsquery($1)) DESC LIMIT $2", query, limit)`},
+		{"mysql", `"SELECT id, title, body, MATCH (title, body) AGAINST (?) FROM post WHERE MATCH (title, body) AGAINST (?) ORDER BY MATCH (title, body) AGAINST (?) DESC LIMIT ?", query, query, query, limit)`},
+		{"sqlite", ""},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Funcs: "search"}, code)
+		if test.expected == "" {
+			if strings.Contains(src, "func SearchPosts(") {
+				t.Errorf("%s: expected no SearchPosts; found:\n%s\n", test.dialect, src)
+			}
+			continue
+		}
+		if !strings.Contains(src, test.expected) || !strings.Contains(src, "&s.Score,") {
+			t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, test.expected, src)
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	tests := []struct {
+		dialect string
+		offset  string
+		keyset  string
+	}{
+		{"postgres", `SelectPost+" ORDER BY id LIMIT $1 OFFSET $2", limit, offset)`, `SelectPost+" WHERE id > $1 ORDER BY id LIMIT $2", cursor, limit)`},
+		{"mysql", `SelectPost+" ORDER BY id LIMIT ? OFFSET ?", limit, offset)`, `SelectPost+" WHERE id > ? ORDER BY id LIMIT ?", cursor, limit)`},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Funcs: "list"}, code)
+		for _, expected := range []string{"func ListPost(", "func ListPostAfter(ctx context.Context, db DBTX, cursor int64, limit int)", test.offset, test.keyset} {
+			if !strings.Contains(src, expected) {
+				t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, expected, src)
+			}
+		}
+	}
+}
+
+func TestCheckRows(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Funcs: "list", CheckRows: 100}, code)
+	for _, expected := range []string{
+		"return ScanPostsContext(context.Background(), rs)",
+		"func ScanPostsContext(ctx context.Context, rs *sql.Rows) ([]Post, error) {",
+		"if len(structs)%100 == 0 {",
+		"return ScanPostsContext(ctx, rows)",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	src = generate(t, options{Funcs: "list"}, code)
+	if strings.Contains(src, "ScanPostsContext") || !strings.Contains(src, "return ScanPosts(rows)") {
+		t.Errorf("expected scans without context checks; found:\n%s\n", src)
+	}
+}
+
+func TestDBTX(t *testing.T) {
+	code := `package models
+
+import "database/sql"
+
+var (
+	_ DBTX = (*sql.DB)(nil)
+	_ DBTX = (*sql.Tx)(nil)
+	_ DBTX = (*sql.Conn)(nil)
+)
+
+type Post struct {
+	ID    int64
+	Title string
+}
+
+type Tag struct {
+	ID    int64
+	Label string
+}
+`
+	src := generate(t, options{Funcs: "get,upsert"}, code)
+	if found := strings.Count(src, "type DBTX interface"); found != 1 {
+		t.Errorf("expected: 1 DBTX interface; found: %d\n", found)
+	}
+	if !strings.Contains(src, "func GetTag(ctx context.Context, db DBTX, id int64) (Tag, error)") {
+		t.Errorf("expected GetTag taking a DBTX; found:\n%s\n", src)
+	}
+}
+
+func TestUnknownColumns(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n\tRest  map[string]interface{} `db:\",extra\"`\n}\n"
+	tests := []struct {
+		policy   string
+		expected string
+	}{
+		{"error", `return nil, fmt.Errorf("%s: unknown column %q", "post", col)`},
+		{"ignore", "dests[i] = new(interface{})"},
+		{"extra", "s.Rest[col] = *v"},
+	}
+	for _, test := range tests {
+		src := generate(t, options{ByName: true, UnknownColumns: test.policy}, code)
+		if !strings.Contains(src, "func ScanPostsByName(rs *sql.Rows) ([]Post, error)") || !strings.Contains(src, test.expected) {
+			t.Errorf("%s: expected: %s; found:\n%s\n", test.policy, test.expected, src)
+		}
+	}
+
+	opts := options{ByName: true, UnknownColumns: "extra"}
+	if _, err := genFile(&opts, []structToken{{Name: "Post", Fields: []fieldToken{{Name: "ID", Type: "int64"}}}}, nil); err == nil {
+		t.Error("struct Post has no extra field")
+		t.Error("should be error")
+	}
+
+	opts = options{BatchSize: 1, Layout: "single", UnknownColumns: "drop"}
+	if err := opts.check(); err == nil {
+		t.Error("unknown columns policy drop doesn't exist")
+		t.Error("should be error")
+	}
+}
+
+func TestRowScanner(t *testing.T) {
+	code := `package models
+
+import "database/sql"
+
+var (
+	_ RowScanner = (*sql.Row)(nil)
+	_ RowScanner = (*sql.Rows)(nil)
+)
+
+type Post struct {
+	ID    int64
+	Title string
+}
+`
+	src := generate(t, options{}, code)
+	if !strings.Contains(src, "func ScanPost(r RowScanner) (Post, error)") {
+		t.Errorf("expected ScanPost taking a RowScanner; found:\n%s\n", src)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Funcs: "queue"}, code)
+	for _, expected := range []string{
+		"func QueueGetPost(b *pgx.Batch, id int64, dst *Post) {",
+		`b.Queue(SelectPost+" WHERE id = $1", id)`,
+		"func QueueSelectPosts(b *pgx.Batch, dst *[]Post, where string, args ...interface{}) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	opts := options{Dialect: "mysql", Funcs: "queue", BatchSize: 1, Layout: "single", UnknownColumns: "error", Driver: "database/sql"}
+	if err := opts.check(); err == nil {
+		t.Error("queue helpers need postgres")
+		t.Error("should be error")
+	}
+}
+
+func TestScanMaps(t *testing.T) {
+	code := `package models
+
+type Post struct {
+	ID    int64
+	Title string
+}
+
+type Blob struct {
+	Hash []byte ` + "`db:\"hash,pk\"`" + `
+	Data string
+}
+
+type Note struct {
+	Text string
+}
+`
+	src := generate(t, options{Maps: true}, code)
+	if !strings.Contains(src, "func ScanPostsMap(rs *sql.Rows) (map[int64]Post, error) {") {
+		t.Errorf("expected ScanPostsMap keyed by int64; found:\n%s\n", src)
+	}
+	if strings.Contains(src, "ScanBlobsMap") || strings.Contains(src, "ScanNotesMap") {
+		t.Errorf("expected no map scans without a comparable primary key; found:\n%s\n", src)
+	}
+}
+
+func TestIter(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Iter: true}, code)
+	if !strings.Contains(src, "func IterPosts(rs *sql.Rows) iter.Seq2[Post, error] {") {
+		t.Errorf("expected IterPosts; found:\n%s\n", src)
+	}
+
+	src = generate(t, options{}, code)
+	if strings.Contains(src, "IterPosts") || strings.Contains(src, `"iter"`) {
+		t.Errorf("expected no iterators without -iter; found:\n%s\n", src)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	code := `package models
+
+import "database/sql"
+
+var (
+	_ DBTX = (*sql.DB)(nil)
+	_ DBTX = (*sql.Tx)(nil)
+)
+
+type Post struct {
+	ID    int64
+	Title string
+}
+`
+	src := generate(t, options{Dialect: "postgres", Funcs: "prepare"}, code)
+	for _, expected := range []string{
+		"func PreparePostStatements(ctx context.Context, db DBTX) (*PostStatements, error) {",
+		`db.PrepareContext(ctx, SelectPost+" WHERE id = $1")`,
+		`db.PrepareContext(ctx, "INSERT INTO post (id, title) VALUES ($1, $2)")`,
+		`db.PrepareContext(ctx, "UPDATE post SET title = $1 WHERE id = $2")`,
+		`db.PrepareContext(ctx, "DELETE FROM post WHERE id = $1")`,
+		"func (st *PostStatements) Close() error {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string `db:\"post_title\"`\n}\n"
+	src := generate(t, options{NamedArgs: true}, code)
+	for _, expected := range []string{
+		"func PostNamedArgs(x Post) []sql.NamedArg {",
+		`sql.Named("post_title", x.Title),`,
+		"func PostArgMap(x Post) map[string]interface{} {",
+		`"post_title": x.Title,`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestUpdateFields(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n\tViews int\n}\n"
+	tests := []struct {
+		dialect  string
+		update   string
+		set      string
+		bindings string
+	}{
+		{"postgres", `"UPDATE post SET title = $1, views = $2 WHERE id = $3"`, `sets[i] = fmt.Sprintf(set, "$"+strconv.Itoa(len(args)))`, `" WHERE id = $1", args...)`},
+		{"mysql", `"UPDATE post SET title = ?, views = ? WHERE id = ?"`, `sets[i] = fmt.Sprintf(set, "?")`, `" WHERE id = ?", args...)`},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Funcs: "update"}, code)
+		for _, expected := range []string{
+			"func UpdatePost(ctx context.Context, db DBTX, x Post) error {",
+			"func UpdatePostFields(ctx context.Context, db DBTX, id int64, fields map[string]interface{}) error {",
+			test.update,
+			`case "views":`,
+			`return fmt.Errorf("%s: can't update column %q", "post", col)`,
+			test.set,
+			test.bindings,
+		} {
+			if !strings.Contains(src, expected) {
+				t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, expected, src)
+			}
+		}
+		if strings.Contains(src, `case "id":`) {
+			t.Errorf("%s: expected the primary key rejected; found:\n%s\n", test.dialect, src)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	code := `package models
+
+import "github.com/jackc/pgx/v5"
+
+var _ pgx.CopyFromSource = (*postCopySource)(nil)
+
+//scaneo:table blog.posts
+type Post struct {
+	ID    int64
+	Title string
+}
+`
+	src := generate(t, options{Dialect: "postgres", Funcs: "copy"}, code)
+	for _, expected := range []string{
+		"func CopyPosts(ctx context.Context, conn Copier, xs []Post) (int64, error) {",
+		`conn.CopyFrom(ctx, pgx.Identifier{"blog", "posts"}, []string{"id", "title"}, &postCopySource{xs: xs})`,
+		"return []interface{}{x.ID, x.Title}, nil",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	opts := options{Dialect: "sqlite", Funcs: "copy", BatchSize: 1, Layout: "single", UnknownColumns: "error", Driver: "database/sql"}
+	if err := opts.check(); err == nil || err.Error() != "copy helpers need the postgres dialect" {
+		t.Errorf("expected: copy helpers need the postgres dialect; found: %v\n", err)
+	}
+}
+
+func TestMapFuncs(t *testing.T) {
+	code := "package models\n\nimport \"time\"\n\ntype Post struct {\n\tID      int64\n\tTitle   string `db:\"post_title\"`\n\tCreated time.Time\n}\n"
+	src := generate(t, options{MapFuncs: true}, code)
+	for _, expected := range []string{
+		"func PostToMap(x Post) map[string]interface{} {",
+		`"post_title": x.Title,`,
+		"func PostFromMap(m map[string]interface{}) (Post, error) {",
+		"x.Created, ok = v.(time.Time)",
+		`return x, fmt.Errorf("%s: unknown column %q", "post", col)`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestLogQueries(t *testing.T) {
+	toks := fileStructsMap[testFiles[3]][:1]
+	outFile := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d", time.Now().UnixNano()))
+	opts := &options{Output: outFile, Package: "testing", Dialect: "postgres", Driver: "pgx", Funcs: "insert", LogQueries: true}
+
+	if _, err := genFile(opts, toks, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outFile)
+
+	src, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []string{"var QueryLogger func(", "func (r loggedRow) Scan(", "db = logged(db)"} {
+		if !strings.Contains(string(src), code) {
+			t.Errorf("expected %s\n", code)
+		}
+	}
+}
+
+func TestTypeTables(t *testing.T) {
+	opts := &options{
+		Dialect: "postgres",
+		Types: map[string]typeMap{
+			"postgres": {
+				Go:  map[string]string{"Email": "citext"},
+				SQL: map[string]string{"citext": "text", "geometry": "wkt"},
+			},
+		},
+	}
+
+	if sqlType := opts.sqlType("Email"); sqlType != "citext" {
+		t.Errorf("expected: citext; found: %s\n", sqlType)
+	}
+	if sqlType := opts.sqlType("time.Time"); sqlType != "timestamptz" {
+		t.Errorf("expected: timestamptz; found: %s\n", sqlType)
+	}
+
+	strat, err := opts.strategy("citext")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if strat.Temp != "string" {
+		t.Errorf("expected: string; found: %s\n", strat.Temp)
+	}
+
+	if _, err := opts.strategy("geometry"); err == nil {
+		t.Error("strategy wkt isn't declared")
+		t.Error("should be error")
+	}
+}
+
+func TestArrays(t *testing.T) {
+	opts := &options{Dialect: "postgres", Driver: "database/sql"}
+	strat, err := opts.strategy(opts.sqlType("[]string"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if strat.Dest != "pq.Array(%s)" {
+		t.Errorf("expected: pq.Array(%%s); found: %s\n", strat.Dest)
+	}
+
+	opts.Driver = "pgx"
+	strat, err = opts.strategy(opts.sqlType("[]string"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if strat.Dest != "" {
+		t.Errorf("expected: direct; found: %s\n", strat.Dest)
+	}
+}
+
+func TestPgtype(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\nimport \"github.com/jackc/pgx/v5/pgtype\"\n\n" +
+		"type Span struct {\n\tLength pgtype.Interval\n\tAttrs pgtype.Hstore `db:\"attrs,hstore\"`\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{Dialect: "postgres", Driver: "pgx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range toks[0].Fields {
+		if f.Strategy.Temp != "" || f.Strategy.Column != "" {
+			t.Errorf("%s: expected pgx to scan directly; found: %+v\n", f.Name, f.Strategy)
+		}
+		if len(f.Strategy.Imports) != 1 || f.Strategy.Imports[0] != "github.com/jackc/pgx/v5/pgtype" {
+			t.Errorf("%s: expected pgtype import; found: %v\n", f.Name, f.Strategy.Imports)
+		}
+	}
+
+	if comparable("pgtype.Hstore") {
+		t.Error("pgtype.Hstore is a map")
+	}
+}
+
+func TestImportAliases(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\nimport (\n\tlpq \"github.com/lib/pq\"\n\tpq \"github.com/lib/pq\"\n)\n\n" +
+		"type Event struct {\n\tID lpq.NullTime `db:\"id,pk\"`\n\tAt pq.NullTime\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{Dialect: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imports := strings.Join(toks[0].Imports, ","); imports != "lpq github.com/lib/pq,github.com/lib/pq" {
+		t.Errorf("expected the lpq alias to be kept; found: %v\n", toks[0].Imports)
+	}
+
+	outFile := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d", time.Now().UnixNano()))
+	if _, err := genFile(&options{Output: outFile, Package: "testing", Dialect: "postgres", Funcs: "get"}, toks, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outFile)
+
+	out, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `lpq "github.com/lib/pq"`) {
+		t.Error("expected the lpq alias to be imported")
+	}
+}
+
+func TestResolveScanners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Email is declared in a file scaneo isn't given
+	email := `package models
+
+import "database/sql/driver"
+
+type Email string
+
+func (e *Email) Scan(src interface{}) error { return nil }
+
+func (e Email) Value() (driver.Value, error) { return string(e), nil }
+`
+	src := filepath.Join(dir, "member.go")
+	code := `package models
+
+type Handle string
+
+type Member struct {
+	Email  Email
+	Alt    *Email
+	Handle Handle
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "email.go"), []byte(email), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{
+		Dialect: "postgres",
+		Types: map[string]typeMap{
+			"postgres": {
+				Go:  map[string]string{"Email": "citext", "Handle": "citext"},
+				SQL: map[string]string{"citext": "text"},
+			},
+		},
+	}
+	toks, err := parseCode("example.com/models", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolveTypes(toks, loadPackages(importMap{"example.com/models": {src}}))
+	if toks[0].Fields[0].GoType == nil || toks[0].Fields[0].GoType.String() != "models.Email" {
+		t.Errorf("expected Email to resolve to models.Email; found: %v\n", toks[0].Fields[0].GoType)
+	}
+
+	resolveScanners(toks)
+
+	for _, f := range toks[0].Fields {
+		if converts := f.converts(); converts != (f.Name == "Handle") {
+			t.Errorf("%s: expected conversion only for Handle; found: %+v\n", f.Name, f.Strategy)
+		}
+	}
+}
+
+func TestResolveBaseTypes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "user.go")
+	code := `package models
+
+type UserID int64
+
+type Name = string
+
+type Tags []string
+
+type Rev int32
+
+type User struct {
+	ID   UserID
+	Name Name
+	Tags Tags
+	Rev  Rev ` + "`db:\"rev,version\"`" + `
+}
+`
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{Dialect: "postgres"}
+	toks, err := parseCode("example.com/models", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs := loadPackages(importMap{"example.com/models": {src}})
+	resolveTypes(toks, pkgs)
+	if err := resolveBaseTypes(toks, pkgs, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"ID": "int64", "Name": "string", "Tags": "[]string", "Rev": "int32"}
+	for _, f := range toks[0].Fields {
+		if f.BaseType() != expected[f.Name] {
+			t.Errorf("%s: expected base type %s; found: %s\n", f.Name, expected[f.Name], f.BaseType())
+		}
+	}
+	if tags := toks[0].Fields[2]; tags.SQLType != "text[]" || tags.Strategy.Value != "pq.Array([]string(%s))" {
+		t.Errorf("expected Tags to be stored as a text array; found: %s %+v\n", tags.SQLType, tags.Strategy)
+	}
+}
+
+func TestResolveEmbeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the embedded structs are declared in a file scaneo isn't given
+	common := `package models
+
+import "time"
+
+type Timestamps struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Model struct {
+	ID int64
+	Timestamps
+}
+`
+	src := filepath.Join(dir, "post.go")
+	code := `package models
+
+type Post struct {
+	Model
+	Title string
+}
+
+type Tag struct {
+	Name string ` + "`db:\"name,pk\"`" + `
+	Timestamps
+	UpdatedAt int64 ` + "`db:\"-\"`" + `
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "common.go"), []byte(common), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{}
+	toks, err := parseCode("example.com/models", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveEmbeds(toks, importMap{"example.com/models": {src}}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"Post": "ID,CreatedAt,UpdatedAt,Title", "Tag": "Name,CreatedAt"}
+	for _, tok := range toks {
+		names := make([]string, len(tok.Fields))
+		for i, f := range tok.Fields {
+			names[i] = f.Name
+		}
+		if found := strings.Join(names, ","); found != expected[tok.Name] {
+			t.Errorf("%s: expected fields %s; found: %s\n", tok.Name, expected[tok.Name], found)
+		}
+	}
+	if pk := toks[0].PK(); pk == nil || pk.Name != "ID" {
+		t.Errorf("expected the embedded ID to be the primary key of Post; found: %v\n", pk)
+	}
+}
+
+func TestPrefixedFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "user.go")
+	code := "package models\n\ntype Address struct {\n\tStreet string\n\tCity string\n}\n\n" +
+		"type User struct {\n\tID int64\n\tHome Address `db:\"home,prefix=addr_\"`\n\tWork Address `db:\"work,prefix\"`\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{Whitelist: "User"}
+	toks, err := parseCode("example.com/models", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveEmbeds(toks, importMap{"example.com/models": {src}}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, f := range toks[0].Fields {
+		found = append(found, f.Name+" "+f.Column)
+	}
+	expected := "ID id,Home.Street addr_street,Home.City addr_city,Work.Street work_street,Work.City work_city"
+	if strings.Join(found, ",") != expected {
+		t.Errorf("expected: %s; found: %s\n", expected, strings.Join(found, ","))
+	}
+}
+
+func TestPackageDeclarations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// only post.go is given, the rest of the package is declared elsewhere
+	other := `package models
+
+import "context"
+
+type Point struct {
+	X float64
+	Y float64
+}
+
+const KindNote Kind = "note"
+
+func (p *Post) AfterScan(ctx context.Context) error { return nil }
+`
+	src := filepath.Join(dir, "post.go")
+	code := "package models\n\ntype Kind string\n\ntype Post struct {\n\tID int64\n\tAt Point `db:\"at,composite\"`\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.go"), []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{Dialect: "postgres", Driver: "pgx"}
+	importmap := importMap{"example.com/models": {src}}
+	toks, err := parseCode("example.com/models", src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resolveComposites(toks, importmap, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(toks[0].Fields[1].Sub) != 2 {
+		t.Errorf("expected the fields of Point; found: %v\n", toks[0].Fields[1].Sub)
+	}
+
+	resolveHooks(toks, loadPackages(importmap))
+	if !toks[0].Hooks["AfterScan"] {
+		t.Error("expected the AfterScan hook declared in another file")
+	}
+
+	enums, err := parseEnums([]string{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enums) != 1 || len(enums[0].Consts) != 1 {
+		t.Errorf("expected Kind with the constant declared in another file; found: %v\n", enums)
+	}
+}
+
+func TestGenericStructs(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\ntype Page[T any] struct {\n\tItems []T\n\tTotal int\n}\n\n" +
+		"type Post struct {\n\tID int64\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toks) != 1 || toks[0].Name != "Post" {
+		t.Errorf("expected only Post; found: %v\n", toks)
+	}
+}
+
+func TestUnsupportedFields(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := "package models\n\ntype Job struct {\n\tID int64\n\tDone chan bool\n\tRun func() error\n\tName string\n}\n"
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	toks, err := parseCode("", src, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toks[0].Fields) != 2 {
+		t.Errorf("expected the chan and func fields to be skipped; found: %v\n", toks[0].Fields)
+	}
+
+	_, err = parseCode("", src, &options{StrictFields: true})
+	if err == nil || !strings.Contains(err.Error(), "field Done has unsupported type chan bool") {
+		t.Errorf("expected an error naming field Done; found: %v\n", err)
+	}
+}
+
+func TestUnsupportedMaps(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	defer os.Remove(src)
+
+	tests := []struct {
+		dialect string
+		field   string
+		kept    bool
+	}{
+		{"postgres", "Attrs map[string]string", true},
+		{"postgres", "Attrs map[string]string `db:\"attrs,hstore\"`", true},
+		{"postgres", "Attrs map[string]*string", false},
+		{"postgres", "Attrs map[string]int `db:\"attrs,hstore\"`", false},
+		{"postgres", "Attrs map[string]interface{} `db:\",extra\"`", true},
+		{"mysql", "Attrs map[string]string", false},
+		{"mysql", "Attrs map[string]string `db:\"attrs,hstore\"`", false},
+		{"sqlite", "Attrs map[int]string", false},
+	}
+
+	for _, test := range tests {
+		code := "package models\n\ntype Shop struct {\n\tID int64\n\t" + test.field + "\n}\n"
+		if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		toks, err := parseCode("", src, &options{Dialect: test.dialect})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := len(toks[0].Fields) == 2 || toks[0].Extra != nil
+		if kept != test.kept {
+			t.Errorf("%s %s: expected kept %t; found: %t\n", test.dialect, test.field, test.kept, kept)
+		}
+
+		_, err = parseCode("", src, &options{Dialect: test.dialect, StrictFields: true})
+		if (err == nil) != test.kept {
+			t.Errorf("%s %s: expected strict error %t; found: %v\n", test.dialect, test.field, !test.kept, err)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	snakes := map[string]string{
+		"ID":         "id",
+		"SemURL":     "sem_url",
+		"HTTPServer": "http_server",
+		"CreatedAt":  "created_at",
+		"t0":         "t0",
+	}
+	for name, expected := range snakes {
+		if found := snakeCase(name); expected != found {
+			t.Errorf("expected: %s; found: %s\n", expected, found)
+		}
+	}
+
+	params := map[string]string{
+		"ID":      "id",
+		"URLPath": "urlPath",
+		"Email":   "email",
+		"Type":    "typeArg",
+	}
+	for name, expected := range params {
+		if found := (fieldToken{Name: name}).Param(); expected != found {
+			t.Errorf("expected: %s; found: %s\n", expected, found)
+		}
+	}
+
+	initials := map[string]string{
+		"models": "Models",
+		"élan":   "Élan",
+		"":       "",
+	}
+	for name, expected := range initials {
+		if found := upperInitial(name); expected != found {
+			t.Errorf("expected: %s; found: %s\n", expected, found)
+		}
+	}
+}
+
+func TestImportName(t *testing.T) {
+	names := map[string]string{
+		"time":                           "time",
+		"database/sql":                   "sql",
+		"github.com/jackc/pgx/v5":        "pgx",
+		"github.com/jackc/pgx/v5/pgtype": "pgtype",
+		"github.com/Rhymond/go-money":    "money",
+		"gopkg.in/yaml.v2":               "yaml",
+	}
+	for path, expected := range names {
+		if found := importName(path); expected != found {
+			t.Errorf("expected: %s; found: %s\n", expected, found)
+		}
+	}
+}
+
+func TestStampOutput(t *testing.T) {
+	a, err := newStamp(&options{Output: "/home/a/src/models/scans.go", Dialect: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newStamp(&options{Output: "/builds/b/models/scans.go", Dialect: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Fingerprint != b.Fingerprint || !strings.Contains(a.Options, `"output":"scans.go"`) {
+		t.Errorf("expected the output recorded relative to its package; found: %s and %s\n", a.Options, b.Options)
+	}
+}
+
+func TestChooseTargets(t *testing.T) {
+	targets := []target{{Dir: "models"}, {Dir: "store"}, {Dir: "web"}}
+
+	chosen, err := chooseTargets(targets, "all")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(chosen) != len(targets) {
+		t.Errorf("expected: %d; found: %d\n", len(targets), len(chosen))
+	}
+
+	chosen, err = chooseTargets(targets, "1, 3")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(chosen) != 2 || chosen[0].Dir != "models" || chosen[1].Dir != "web" {
+		t.Error("unexpected targets:", chosen)
+	}
+
+	if _, err := chooseTargets(targets, "4"); err == nil {
+		t.Error("chose a target that doesn't exist")
+		t.Error("should be error")
+	}
+}
+
+func TestUpdateSQL(t *testing.T) {
+	tok := structToken{
+		Table: "doc",
+		Fields: []fieldToken{
+			{Column: "id", PK: true},
+			{Column: "body"},
+			{Column: "version", Opts: map[string]string{"version": ""}},
+		},
+	}
+
+	expected := "UPDATE doc SET body = $1, version = version + 1 WHERE id = $2 AND version = $3"
+	if found := dialects["postgres"].updateSQL(tok); found != expected {
+		t.Error("unexpected versioned update")
+		t.Errorf("expected: %s; found: %s\n", expected, found)
+	}
+
+	tok.Fields = tok.Fields[:2]
+	expected = "UPDATE doc SET body = $1 WHERE id = $2"
+	if found := dialects["postgres"].updateSQL(tok); found != expected {
+		t.Error("unexpected update")
+		t.Errorf("expected: %s; found: %s\n", expected, found)
+	}
+}
+
+func TestDeletedAt(t *testing.T) {
+	tok := structToken{
+		Fields: []fieldToken{
+			{Name: "ID", Column: "id", PK: true},
+			{Name: "DeletedAt", Column: "deleted_at"},
+		},
+	}
+	if f := tok.DeletedAt(); f == nil || f.Name != "DeletedAt" {
+		t.Error("deleted_at column not found:", f)
+	}
+
+	tok.Fields = append(tok.Fields, fieldToken{Name: "Removed", Column: "removed", Opts: map[string]string{"softdelete": ""}})
+	if f := tok.DeletedAt(); f == nil || f.Name != "Removed" {
+		t.Error("field tagged softdelete not found:", f)
+	}
+
+	tok.Fields = tok.Fields[:1]
+	if f := tok.DeletedAt(); f != nil {
+		t.Error("unexpected soft delete field:", f)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	tests := map[string]fieldToken{
+		"old.Name != new.Name":                   {Name: "Name", Type: "string"},
+		"!old.At.Equal(new.At)":                  {Name: "At", Type: "time.Time"},
+		"!reflect.DeepEqual(old.Tags, new.Tags)": {Name: "Tags", Type: "[]string"},
+		"!reflect.DeepEqual(old.Refs, new.Refs)": {Name: "Refs", Type: "*[]string"},
+		"(old.Nick == nil) != (new.Nick == nil) || old.Nick != nil && *old.Nick != *new.Nick": {
+			Name: "Nick", Type: "*string",
+		},
+		"(old.DeletedAt == nil) != (new.DeletedAt == nil) || old.DeletedAt != nil && !old.DeletedAt.Equal(*new.DeletedAt)": {
+			Name: "DeletedAt", Type: "*time.Time",
+		},
+	}
+	for expected, f := range tests {
+		if found := changed(f); found != expected {
+			t.Errorf("%s: expected: %s; found: %s\n", f.Type, expected, found)
+		}
+	}
+
+	code := "package models\n\nimport \"time\"\n\ntype Post struct {\n\tID        int64\n\tNick      *string\n\tTags      []string\n\tDeletedAt *time.Time\n}\n"
+	src := generate(t, options{Dialect: "postgres", Funcs: "update"}, code)
+	if !strings.Contains(src, "func PostChangedColumns(old, new Post) ([]string, []interface{}) {") {
+		t.Errorf("expected PostChangedColumns; found:\n%s\n", src)
+	}
+}
+
+func TestCreateSQL(t *testing.T) {
+	tok := structToken{
+		Table: "post",
+		Fields: []fieldToken{
+			{Column: "id", PK: true, Opts: map[string]string{"auto": ""}},
+			{Column: "title"},
+		},
+	}
+
+	expected := map[string]string{
+		"postgres": "INSERT INTO post (title) VALUES ($1) RETURNING id",
+		"mysql":    "INSERT INTO post (title) VALUES (?)",
+		"mssql":    "INSERT INTO post (title) OUTPUT INSERTED.id VALUES (@p1)",
+		"oracle":   "INSERT INTO post (title) VALUES (:1) RETURNING id INTO :2",
+	}
+	for name, query := range expected {
+		if found := dialects[name].createSQL(tok); found != query {
+			t.Error("unexpected insert for", name)
+			t.Errorf("expected: %s; found: %s\n", query, found)
+		}
+	}
+}
+
+func TestNamed(t *testing.T) {
+	tok := structToken{
+		Table: "post",
+		Fields: []fieldToken{
+			{Column: "id", PK: true},
+			{Column: "title"},
+			{Column: "version", Opts: map[string]string{"version": ""}},
+		},
+	}
+
+	expected := "UPDATE post SET title = :title, version = version + 1 WHERE id = :id AND version = :version"
+	if found := dialects["postgres"].named(dialect.updateSQL, tok, tok.updateFields()); found != expected {
+		t.Errorf("expected: %s; found: %s\n", expected, found)
+	}
+}
+
+func TestIdent(t *testing.T) {
+	expected := map[string]string{
+		"postgres": `"user"`,
+		"mysql":    "`user`",
+		"mssql":    "[user]",
+	}
+	for name, ident := range expected {
+		if found := dialects[name].ident("user"); found != ident {
+			t.Errorf("%s: expected: %s; found: %s\n", name, ident, found)
+		}
+		if found := dialects[name].ident("auth.user"); found != "auth."+ident {
+			t.Errorf("%s: expected: auth.%s; found: %s\n", name, ident, found)
+		}
+	}
+
+	if found := dialects["mssql"].ident("post"); found != "post" {
+		t.Errorf("expected: post; found: %s\n", found)
+	}
+
+	d := dialects["postgres"]
+	d.quoteAll = true
+	if found := d.ident("auth.post"); found != `"auth"."post"` {
+		t.Errorf(`expected: "auth"."post"; found: %s\n`, found)
+	}
+}
+
+func TestPerDialect(t *testing.T) {
+	opts := options{Output: "scans.go", Dialect: "postgres,mysql"}
+
+	found := opts.perDialect()
+	if len(found) != 2 {
+		t.Fatalf("expected 2 options; found %d\n", len(found))
+	}
+	if found[1].Dialect != "mysql" || found[1].Output != "scans_mysql.go" || found[1].BuildTag != "mysql" {
+		t.Errorf("unexpected mysql options: %+v\n", found[1])
+	}
+
+	opts.Dialect = "postgres"
+	if found := opts.perDialect(); len(found) != 1 || found[0].Output != "scans.go" || found[0].BuildTag != "" {
+		t.Errorf("unexpected single dialect options: %+v\n", found)
+	}
+}
+
+func TestClickHouseMutations(t *testing.T) {
+	for _, fn := range []string{"batch", "upsert", "update", "delete", "prepare"} {
+		opts := options{Dialect: "clickhouse", Driver: "database/sql", Funcs: fn, Layout: "single", UnknownColumns: "error", BatchSize: 500}
+		err := opts.check()
+		if fn == "batch" && err != nil {
+			t.Errorf("%s: %s\n", fn, err)
+		} else if fn != "batch" && err == nil {
+			t.Errorf("%s: expected an error for a mutation on clickhouse\n", fn)
+		}
+	}
+}
+
+func TestRowsPerInsert(t *testing.T) {
+	tok := structToken{Fields: make([]fieldToken, 10)}
+
+	tests := []struct {
+		dialect   string
+		maxParams int
+		expected  int
+	}{
+		{"postgres", 0, 5000},
+		{"mssql", 0, 210},
+		{"postgres", 1000, 100},
+		{"mssql", 100000, 1000},
+	}
+	for _, test := range tests {
+		if found := dialects[test.dialect].rowsPerInsert(tok, 5000, test.maxParams); found != test.expected {
+			t.Errorf("%s, max %d: expected: %d; found: %d\n", test.dialect, test.maxParams, test.expected, found)
+		}
+	}
+
+	// an auto primary key takes no parameter
+	tok.Fields = []fieldToken{{PK: true, Opts: map[string]string{"auto": ""}}, {}, {}}
+	if found := dialects["postgres"].rowsPerInsert(tok, 5000, 4); found != 2 {
+		t.Errorf("expected: 2; found: %d\n", found)
+	}
+}
+
+func TestBatchAutoPK(t *testing.T) {
+	code := "package models\n\ntype Item struct {\n\tID   int64  `db:\"id,pk,auto\"`\n\tName string\n}\n"
+	tests := []struct {
+		opts     options
+		expected []string
+	}{
+		{options{Dialect: "postgres", Funcs: "batch,copy", BatchSize: 500}, []string{
+			`"INSERT INTO item (name) VALUES "`, `fmt.Fprintf(&b, "($%d)", p+1)`,
+			`[]interface{}{x.Name}`, `[]string{"name"}`,
+		}},
+		{options{Dialect: "mysql", Funcs: "batch", BatchSize: 500}, []string{`"INSERT INTO item (name) VALUES "`, `b.WriteString("(?)")`}},
+		{options{Dialect: "clickhouse", Funcs: "batch", BatchSize: 500}, []string{`"INSERT INTO item (name)"`, `batch.Append(x.Name)`}},
+	}
+	for _, test := range tests {
+		src := generate(t, test.opts, code)
+		for _, expected := range test.expected {
+			if !strings.Contains(src, expected) {
+				t.Errorf("%s: expected: %s; found:\n%s\n", test.opts.Dialect, expected, src)
+			}
+		}
+	}
+}
+
+func TestInsertAutoPK(t *testing.T) {
+	code := "package models\n\ntype Item struct {\n\tID   int32  `db:\"id,pk,auto\"`\n\tName string\n}\n"
+	tests := []struct {
+		dialect  string
+		expected []string
+	}{
+		{"postgres", []string{`return db.QueryRowContext(ctx, "INSERT INTO item (name) VALUES ($1) RETURNING id",`, ").Scan(&x.ID)"}},
+		{"mysql", []string{`res, err := db.ExecContext(ctx, "INSERT INTO item (name) VALUES (?)",`, "x.ID = int32(id)"}},
+		{"sqlite", []string{`res, err := db.ExecContext(ctx, "INSERT INTO item (name) VALUES (?)",`, "x.ID = int32(id)"}},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Funcs: "insert,prepare"}, code)
+		for _, expected := range test.expected {
+			if !strings.Contains(src, expected) {
+				t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, expected, src)
+			}
+		}
+	}
+}
+
+func TestSquirrel(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	tests := []struct {
+		dialect  string
+		expected string
+	}{
+		{"postgres", `return squirrel.Select("id", "title").From("post").PlaceholderFormat(squirrel.Dollar)`},
+		{"mysql", `return squirrel.Select("id", "title").From("post")` + "\n"},
+	}
+	for _, test := range tests {
+		src := generate(t, options{Dialect: test.dialect, Squirrel: true}, code)
+		if !strings.Contains(src, "func PostSelectBuilder() squirrel.SelectBuilder {") || !strings.Contains(src, test.expected) {
+			t.Errorf("%s: expected: %s; found:\n%s\n", test.dialect, test.expected, src)
+		}
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	code := `package models
+
+import "database/sql"
+
+var (
+	_ TxBeginner = (*sql.DB)(nil)
+	_ TxBeginner = (*sql.Conn)(nil)
+)
+
+type Post struct {
+	ID    int64
+	Title string
+}
+`
+	src := generate(t, options{Dialect: "postgres", Repo: true}, code)
+	for _, expected := range []string{
+		"func WithPostTx(ctx context.Context, db TxBeginner, fn func(*PostRepo) error) error {",
+		"if err := fn(NewPostRepo(tx)); err != nil {",
+		"return tx.Commit()",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestRowsAffected(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	affected := []string{
+		"func UpdatePostAffected(ctx context.Context, db DBTX, x Post) (int64, error) {",
+		"func DeletePostAffected(ctx context.Context, db DBTX, id int64) (int64, error) {",
+	}
+
+	src := generate(t, options{Dialect: "postgres", Funcs: "update,delete,prepare", Repo: true, Strict: true}, code)
+	for _, expected := range append(affected, "var ErrNoRowsAffected = errors.New(\"no rows affected\")", "return ErrNoRowsAffected") {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	src = generate(t, options{Dialect: "postgres", Funcs: "update,delete,prepare", Repo: true}, code)
+	for _, expected := range affected {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+	if strings.Contains(src, "ErrNoRowsAffected") {
+		t.Errorf("expected no ErrNoRowsAffected without -strict; found:\n%s\n", src)
+	}
+}
+func TestResolveHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaneo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{
+		"models.go": `package models
+
+import "context"
+
+type Post struct {
+	ID int64
+}
+
+func (p *Post) AfterScan(ctx context.Context) error { return nil }
+
+func (p Post) BeforeInsert() error { return nil }
+
+type Tag struct {
+	Audited
+	ID int64
+}
+
+type Note struct {
+	ID int64
+}
+
+func (n Note) BeforeInsert(ctx context.Context) error { return nil }
+
+func (n Note) Validate() error { return nil }
+`,
+		"audit.go": `package models
+
+import "context"
+
+type Audited struct{}
+
+func (a *Audited) BeforeInsert(ctx context.Context) error { return nil }
+`,
+	}
+	var paths []string
+	for name, code := range sources {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	toks := []structToken{{Name: "Post"}, {Name: "Tag"}, {Name: "Note"}}
+	resolveHooks(toks, loadPackages(importMap{"": paths}))
+
+	expected := []map[string]bool{
+		{"AfterScan": true},
+		{"BeforeInsert": true},
+		{"BeforeInsert": true, "Validate": true},
+	}
+	for i, tok := range toks {
+		if fmt.Sprint(tok.Hooks) != fmt.Sprint(expected[i]) {
+			t.Errorf("%s: expected: %v; found: %v\n", tok.Name, expected[i], tok.Hooks)
+		}
+	}
+
+	src := generate(t, options{Dialect: "postgres", Funcs: "get,insert"}, sources["models.go"]+sources["audit.go"][len("package models\n\nimport \"context\"\n"):])
+	for _, expected := range []string{"if err := s.AfterScan(context.Background()); err != nil {", "if err := x.BeforeInsert(ctx); err != nil {"} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	code := "package models\n\ntype Item struct {\n\tID   int64\n\tName string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Funcs: "insert,upsert,update,delete,prepare", Repo: true, Audit: true}, code)
+	for _, expected := range []string{
+		"var AuditFunc func(ctx context.Context, table, op string, pk interface{})",
+		`AuditFunc(ctx, "item", "insert", x.ID)`,
+		`AuditFunc(ctx, "item", "upsert", x.ID)`,
+		`AuditFunc(ctx, "item", "update", id)`,
+		`AuditFunc(ctx, "item", "delete", id)`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	// updates of no fields execute nothing to audit
+	fn := src[strings.Index(src, "func UpdateItemFields("):]
+	if strings.Index(fn, "defer func()") < strings.Index(fn, "len(fields) == 0") {
+		t.Errorf("expected the audit after the early return of no fields:\n%s\n", fn)
+	}
+
+	src = generate(t, options{Dialect: "postgres", Funcs: "insert,update"}, code)
+	if strings.Contains(src, "AuditFunc") {
+		t.Errorf("expected no audit without -audit; found:\n%s\n", src)
+	}
+}
+
+func TestCursors(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tSlug  string `db:\"slug,pk\"`\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Funcs: "list"}, code)
+	for _, expected := range []string{
+		"func EncodePostCursor(x Post) string {",
+		"b, _ := json.Marshal(x.Slug)",
+		"func DecodePostCursor(s string) (string, error) {",
+		"func ListPostAfter(ctx context.Context, db DBTX, cursor string, limit int) ([]Post, error) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestMSSQL(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "mssql", Funcs: "get,update,batch", Squirrel: true}, code)
+	for _, expected := range []string{
+		`SelectPost+" WHERE id = @p1"`,
+		`"UPDATE post SET title = @p1 WHERE id = @p2"`,
+		`fmt.Fprintf(&b, "(@p%d, @p%d)", p+1, p+2)`,
+		".PlaceholderFormat(squirrel.AtP)",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	opts := options{Dialect: "mssql", Funcs: "upsert", BatchSize: 1, Layout: "single", UnknownColumns: "error", Driver: "database/sql"}
+	if err := opts.check(); err == nil || err.Error() != "upsert helpers don't support the mssql dialect" {
+		t.Errorf("expected: upsert helpers don't support the mssql dialect; found: %v\n", err)
+	}
+}
+
+func TestLooseTypes(t *testing.T) {
+	code := "package models\n\nimport \"time\"\n\ntype Post struct {\n\tID      int64\n\tActive  bool\n\tCreated time.Time\n}\n"
+	src := generate(t, options{Dialect: "sqlite", LooseTypes: true}, code)
+	for _, expected := range []string{
+		"(*sqliteBool)(&s.Active)",
+		"(*sqliteTime)(&s.Created)",
+		"type sqliteBool bool",
+		"type sqliteTime time.Time",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	if src := generate(t, options{Dialect: "sqlite"}, code); strings.Contains(src, "sqliteBool") {
+		t.Errorf("expected no loose types without -loose-types; found:\n%s\n", src)
+	}
+
+	opts := options{Dialect: "postgres", LooseTypes: true, BatchSize: 1, Layout: "single", UnknownColumns: "error", Driver: "database/sql"}
+	if err := opts.check(); err == nil || err.Error() != "loose types need the sqlite dialect" {
+		t.Errorf("expected: loose types need the sqlite dialect; found: %v\n", err)
+	}
+}
+
+func TestRetryTx(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Repo: true, RetryTx: 3}, code)
+	for _, expected := range []string{
+		"func isSerializationFailure(err error) bool {",
+		"for retries := 0; ; retries++ {",
+		"if retries == 3 || !isSerializationFailure(err) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	tests := []struct {
+		opts     options
+		expected string
+	}{
+		{options{Dialect: "postgres", RetryTx: 3}, "transaction retries need -repo"},
+		{options{Dialect: "postgres", Repo: true, RetryTx: -1}, "transaction retries can't be negative, got -1"},
+	}
+	for _, test := range tests {
+		test.opts.BatchSize, test.opts.Layout, test.opts.UnknownColumns, test.opts.Driver = 500, "single", "error", "database/sql"
+		if err := test.opts.check(); err == nil || err.Error() != test.expected {
+			t.Errorf("expected: %s; found: %v\n", test.expected, err)
+		}
+	}
+}
+
+func TestPgxDriver(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Driver: "pgx", Funcs: "get,insert,update,delete,batch", Repo: true}, code)
+	for _, expected := range []string{
+		"func ScanPosts(rs pgx.Rows) ([]Post, error) {",
+		"if err == pgx.ErrNoRows {",
+		"db.QueryRow(ctx, ",
+		"db.Exec(ctx, ",
+		"func RowToPost(row pgx.CollectableRow) (Post, error) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+	if strings.Contains(src, `"database/sql"`) {
+		t.Errorf("expected no database/sql import; found:\n%s\n", src)
+	}
+
+	tests := []struct {
+		opts     options
+		expected string
+	}{
+		{options{Dialect: "mysql", Driver: "pgx"}, "the pgx driver doesn't support the mysql dialect"},
+		{options{Dialect: "postgres", Driver: "pgx", Funcs: "prepare"}, "prepare helpers need the database/sql driver"},
+		{options{Dialect: "postgres", Driver: "odbc"}, `unknown driver "odbc", expected one of database/sql, gocql, pgx, spanner, sqlx`},
+	}
+	for _, test := range tests {
+		test.opts.BatchSize, test.opts.Layout, test.opts.UnknownColumns = 500, "single", "error"
+		if err := test.opts.check(); err == nil || err.Error() != test.expected {
+			t.Errorf("expected: %s; found: %v\n", test.expected, err)
+		}
+	}
+}
+
+func TestRowTo(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", RowTo: true}, code)
+	for _, expected := range []string{
+		`"github.com/jackc/pgx/v5"`,
+		"func RowToPost(row pgx.CollectableRow) (Post, error) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	if src := generate(t, options{Dialect: "postgres"}, code); strings.Contains(src, "RowToPost") {
+		t.Errorf("expected no RowTo function without -row-to; found:\n%s\n", src)
+	}
+}
+
+func TestParseEnums(t *testing.T) {
+	src := filepath.Join(os.TempDir(), fmt.Sprintf("scaneo-test-%d.go", time.Now().UnixNano()))
+	code := `package models
+
+type Status string
+
+const (
+	StatusOpen   Status = "open"
+	StatusClosed Status = "closed"
+	StatusNew    Status = "open"
+	StatusNone          = ""
+)
+
+type Kind string
+
+const KindA, KindB Kind = "a", "b"
+
+type Plain string
+
+type Scanned string
+
+const ScannedA Scanned = "a"
+
+func (s *Scanned) Scan(src interface{}) error { return nil }
+`
+	if err := ioutil.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src)
+
+	enums, err := parseEnums([]string{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []enumToken{
+		{Name: "Kind", Consts: []string{"KindA", "KindB"}},
+		{Name: "Status", Consts: []string{"StatusOpen", "StatusClosed"}},
+	}
+	if fmt.Sprint(enums) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v; found: %v\n", expected, enums)
+	}
+}
+
+func TestClickHouseEnums(t *testing.T) {
+	code := `package models
+
+type Status string
+
+const (
+	StatusOpen   Status = "open"
+	StatusClosed Status = "closed"
+)
+
+type Ticket struct {
+	ID     int64  ` + "`db:\"id,pk,auto\"`" + `
+	Status Status ` + "`db:\"status\"`" + `
+}
+`
+	// both the clickhouse-go and the database/sql driver packages are used
+	src := generate(t, options{Dialect: "clickhouse", Funcs: "batch", BatchSize: 500, Enums: true}, code)
+	for _, expected := range []string{
+		`sqldriver "database/sql/driver"`,
+		"func (e Status) Value() (sqldriver.Value, error) {",
+		"conn.PrepareBatch(ctx, ",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestAliasedImports(t *testing.T) {
+	code := `package models
+
+import "github.com/example/driver"
+
+type Status string
+
+const StatusOpen Status = "open"
+
+type Ticket struct {
+	ID     driver.ID ` + "`db:\"id,pk\"`" + `
+	Status Status
+}
+`
+	// the source's driver package clashes with database/sql/driver, which
+	// the Value methods of enums refer to
+	src := generate(t, options{Dialect: "postgres", Funcs: "get", Enums: true}, code)
+	for _, expected := range []string{
+		`exampledriver "github.com/example/driver"`,
+		`"database/sql/driver"`,
+		"func GetTicket(ctx context.Context, db DBTX, id exampledriver.ID) (Ticket, error) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+
+	// renamed imports clashing keep their path's name
+	code = `package models
+
+import sql "github.com/example/driver"
+
+type Ticket struct {
+	ID   sql.ID ` + "`db:\"id,pk\"`" + `
+	Name string
+}
+`
+	src = generate(t, options{Dialect: "postgres", Funcs: "get"}, code)
+	for _, expected := range []string{
+		`"github.com/example/driver"`,
+		"func GetTicket(ctx context.Context, db DBTX, id driver.ID) (Ticket, error) {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected: %s; found:\n%s\n", expected, src)
+		}
+	}
+}
+
+func TestUnsupportedDriverOptions(t *testing.T) {
+	tests := []struct {
+		opts     options
+		expected string
+	}{
+		{options{Driver: "spanner", MaxRows: 100}, "the spanner driver doesn't support -max-rows"},
+		{options{Driver: "spanner", CheckRows: 100}, "the spanner driver doesn't support -check-rows"},
+		{options{Driver: "spanner", Strict: true}, "the spanner driver doesn't support -strict"},
+		{options{Driver: "spanner", Audit: true}, "the spanner driver doesn't support -audit"},
+		{options{Driver: "spanner", LogQueries: true}, "the spanner driver doesn't support -log-queries"},
+		{options{Driver: "spanner", Layout: "split"}, "the spanner driver doesn't support -layout split"},
+		{options{Driver: "gocql", MaxRows: 100}, "the gocql driver doesn't support -max-rows"},
+		{options{Driver: "gocql", CheckRows: 100}, "the gocql driver doesn't support -check-rows"},
+		{options{Driver: "gocql", Strict: true}, "the gocql driver doesn't support -strict"},
+		{options{Driver: "gocql", Audit: true}, "the gocql driver doesn't support -audit"},
+		{options{Driver: "gocql", LogQueries: true}, "the gocql driver doesn't support -log-queries"},
+		{options{Driver: "gocql", Layout: "split"}, "the gocql driver doesn't support -layout split"},
+	}
+	for _, test := range tests {
+		if test.opts.Layout == "" {
+			test.opts.Layout = "single"
+		}
+		test.opts.BatchSize, test.opts.UnknownColumns = 500, "error"
+		if err := test.opts.check(); err == nil || err.Error() != test.expected {
+			t.Errorf("expected: %s; found: %v\n", test.expected, err)
+		}
+	}
+}
+
+func TestOtelOutput(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	src := generate(t, options{Dialect: "postgres", Funcs: "get,count,insert,update,delete,batch", Repo: true, Otel: true, BatchSize: 500}, code)
+	for _, op := range []string{"get", "insertBatch", "list"} {
+		if span := fmt.Sprintf(`Tracer.Start(ctx, "Post.%s"`, op); !strings.Contains(src, span) {
+			t.Errorf("expected: %s; found:\n%s\n", span, src)
+		}
+	}
+}
+
+func TestLogQueriesOutput(t *testing.T) {
+	code := "package models\n\ntype Post struct {\n\tID    int64\n\tTitle string\n}\n"
+	for _, driver := range []string{"database/sql", "pgx"} {
+		opts := options{Dialect: "postgres", Driver: driver, Funcs: "get,list,insert,update,delete", Repo: true, LogQueries: true}
+		if src := generate(t, opts, code); !strings.Contains(src, "db = logged(db)") {
+			t.Errorf("%s: expected: db = logged(db); found:\n%s\n", driver, src)
+		}
+	}
+}
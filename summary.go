@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// writeSummary writes a summary of the generated files in format, text or
+// json.
+func writeSummary(w io.Writer, format string, files []outputFile) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Files []outputFile `json:"files"`
+		}{files})
+	}
+
+	for _, f := range files {
+		if _, err := fmt.Fprintf(w, "%s: %d structs, %d bytes\n", f.Path, f.Structs, f.Bytes); err != nil {
+			return err
+		}
+		for _, warning := range f.Warnings {
+			if _, err := fmt.Fprintf(w, "    warning: %s\n", warning); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -3,35 +3,81 @@ package main
 const (
 	scansText = `{{define "scans"}}// DON'T EDIT *** generated by scaneo *** DON'T EDIT //
 
+//scaneo:version {{.Stamp.Version}}
+//scaneo:templates {{.Stamp.Templates}}
+//scaneo:fingerprint {{.Stamp.Fingerprint}}
+//scaneo:options {{.Stamp.Options}}
+{{with .Opts.BuildTag}}
+//go:build {{.}}
+{{end}}
 package {{.PackageName}}
 
+{{if .Import}}
 import (
-	"database/sql"
 	{{- range $i, $import := .Import }}
-	"{{ $import }}"
+	{{ importSpec $import }}
 	{{- end }}
 )
+{{end}}
+{{if spanner}}{{template "spanner" .}}{{else if gocql}}{{template "gocql" .}}{{else}}
+{{if part "common"}}
+{{template "rowScanner"}}
+{{if or (.Opts.Wants "get") (.Opts.Wants "find") (.Opts.Wants "queue") (.Opts.Wants "prepare") .Opts.Repo}}{{template "notFound"}}{{end}}
+{{if or .Opts.Funcs .Opts.Repo}}{{template "dbtx"}}{{end}}
+{{if .Opts.Repo}}{{template "txBeginner"}}{{end}}
+{{if .Opts.MaxRows}}{{template "tooManyRows"}}{{end}}
+{{if .Opts.Audit}}{{template "auditFunc"}}{{end}}
+{{if .Opts.Otel}}{{template "otel"}}{{end}}
+{{if and .Opts.LogQueries (or .Opts.Funcs .Opts.Repo)}}{{template "queryLogger"}}{{end}}
+{{if .Opts.Wants "copy"}}{{template "copier"}}{{end}}
+{{if and sqlx (.Opts.Wants "insert")}}{{template "namedQueryRow"}}{{end}}
+{{if and (.Opts.Wants "batch") prepareBatch}}{{template "batchPreparer"}}{{end}}
+{{if and .Opts.Strict (or (.Opts.Wants "update") (.Opts.Wants "delete") (.Opts.Wants "prepare") .Opts.Repo)}}{{template "noRowsAffected"}}{{end}}
+{{if and versioned (or (.Opts.Wants "update") (.Opts.Wants "prepare") .Opts.Repo)}}{{template "conflict"}}{{end}}
+{{range .Helpers}}{{template "helpers" .}}{{end}}
+{{range .Enums}}{{template "enum" .}}{{end}}
+{{end}}
+{{if and .Opts.Fixtures (part "write")}}{{template "fixtureRand"}}{{end}}
 
-{{range .Tokens}}func {{$.Visibility}}can{{title .Name}}(r *sql.Row) ({{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}, error) {
-	var s {{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}
-	if err := r.Scan({{range .Fields}}
-		&s.{{.Name}},{{end}}
-	); err != nil {
-		return {{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}{}, err
+{{range .Tokens}}{{if part "read"}}func {{name "scan" .Name}}(r {{name "RowScanner"}}) ({{.TypeName}}, error) {
+	var s {{.TypeName}}
+	if err := {{name "scan" .Name "into"}}(r, &s); err != nil {
+		return {{.TypeName}}{}, err
 	}
 	return s, nil
 }
 
-func {{$.Visibility}}can{{title .Name}}s(rs *sql.Rows) ([]{{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}, error) {
-	structs := make([]{{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}, 0, 16)
+func {{name "scan" .Name "into"}}(r {{name "RowScanner"}}, s *{{.TypeName}}) error {
+	{{- template "temps" .}}
+	if err := r.Scan({{template "dests" .}}
+	); err != nil {
+		return err
+	}
+	{{- template "assigns" .}}
+	{{- afterScan . "context.Background()" "err"}}
+	return nil
+}
+
+func {{name "scan" (print .Name "s")}}(rs {{(driver).Rows}}) ([]{{.TypeName}}, error) {
+	{{- if (opts).CheckRows}}
+	return {{name "scan" (print .Name "s") "context"}}(context.Background(), rs)
+}
+
+func {{name "scan" (print .Name "s") "context"}}(ctx context.Context, rs {{(driver).Rows}}) ([]{{.TypeName}}, error) {
+	{{- end}}
+	structs := make([]{{.TypeName}}, 0, 16)
 	var err error
 	for rs.Next() {
-		var s {{ if .Selector }}{{ .Selector }}.{{ end }}{{.Name}}
-		if err = rs.Scan({{range .Fields}}
-			&s.{{.Name}},{{end}}
+		{{- template "checkCtx"}}
+		var s {{.TypeName}}
+		{{- template "temps" .}}
+		if err = rs.Scan({{template "dests" .}}
 		); err != nil {
 			return nil, err
 		}
+		{{- template "assigns" .}}
+		{{- afterScan . rowsCtx "nil, err"}}
+		{{- template "maxRows" .}}
 		structs = append(structs, s)
 	}
 	if err = rs.Err(); err != nil {
@@ -40,5 +86,1495 @@ func {{$.Visibility}}can{{title .Name}}s(rs *sql.Rows) ([]{{ if .Selector }}{{ .
 	return structs, nil
 }
 
+{{if or pgx $.Opts.RowTo}}{{template "rowTo" .}}{{end}}
+{{if $.Opts.ByName}}{{template "scanByName" .}}{{end}}
+{{if $.Opts.Stream}}{{template "stream" .}}{{end}}
+{{if $.Opts.Iter}}{{template "iter" .}}{{end}}
+{{if and $.Opts.Maps .PK}}{{if comparable .PK.Type}}{{template "scanMap" .}}{{end}}{{end}}
+
+{{if $.Opts.Wants "select"}}
+const {{name "select" .Name}} = {{quote (selectFrom .)}}
+{{end}}
+{{if $.Opts.Squirrel}}{{template "squirrel" .}}{{end}}
+{{if and ($.Opts.Wants "get") .PK}}{{template "get" .}}{{end}}
+{{if $.Opts.Wants "find"}}{{template "find" .}}{{end}}
+{{if and ($.Opts.Wants "search") (canSearch .)}}{{template "search" .}}{{end}}
+{{if and ($.Opts.Wants "list") .PK}}{{template "list" .}}{{end}}
+{{if $.Opts.Wants "count"}}{{template "count" .}}{{end}}
+{{if and ($.Opts.Wants "exists") .PK}}{{template "exists" .}}{{end}}
+{{if $.Opts.Wants "queue"}}{{template "queue" .}}{{end}}
+{{end}}
+{{if part "write"}}
+{{if $.Opts.Wants "insert"}}{{template "insert" .}}{{end}}
+{{if and ($.Opts.Wants "upsert") .PK}}{{template "upsert" .}}{{end}}
+{{if and ($.Opts.Wants "update") .PK}}{{template "update" .}}{{end}}
+{{if and ($.Opts.Wants "delete") .PK}}{{template "delete" .}}{{end}}
+{{if $.Opts.Wants "batch"}}{{template "batch" .}}{{end}}
+{{if and ($.Opts.Wants "copy") (canCopy .)}}{{template "copy" .}}{{end}}
+{{if and ($.Opts.Wants "prepare") .PK}}{{template "prepare" .}}{{end}}
+{{if and $.Opts.Repo .PK}}{{template "repo" .}}{{end}}
+{{if $.Opts.Fixtures}}{{template "fixture" .}}{{end}}
+{{if or $.Opts.NamedArgs (and sqlx (or ($.Opts.Wants "insert") ($.Opts.Wants "upsert") ($.Opts.Wants "update")))}}{{template "namedArgs" .}}{{end}}
+{{if $.Opts.MapFuncs}}{{template "mapFuncs" .}}{{end}}
+{{end}}
+
+{{end}}{{end}}{{end}}
+
+{{define "enum"}}
+// Scan implements sql.Scanner, accepting only the {{.Name}} constants.
+func (e *{{.Name}}) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("can't scan %T into {{.Name}}", src)
+	}
+	switch v := {{.Name}}(s); v {
+	case {{.Cases}}:
+		*e = v
+		return nil
+	}
+	return fmt.Errorf("invalid {{.Name}} %q", s)
+}
+
+// Value implements driver.Valuer, accepting only the {{.Name}} constants.
+func (e {{.Name}}) Value() ({{sqlDriver}}.Value, error) {
+	switch e {
+	case {{.Cases}}:
+		return string(e), nil
+	}
+	return nil, fmt.Errorf("invalid {{.Name}} %q", string(e))
+}
+{{end}}
+
+{{define "scanByName"}}
+func {{name "scan" (print .Name "s") "byName"}}(rs {{(driver).Rows}}) ([]{{.TypeName}}, error) {
+	{{- if pgx}}
+	var err error
+	cols := make([]string, len(rs.FieldDescriptions()))
+	for i, fd := range rs.FieldDescriptions() {
+		cols[i] = fd.Name
+	}
+	{{- else}}
+	cols, err := rs.Columns()
+	if err != nil {
+		return nil, err
+	}
+	{{- end}}
+	{{- if eq (opts).UnknownColumns "error"}}
+	for _, col := range cols {
+		switch col {
+		case {{range $i, $f := .Fields}}{{if $i}}, {{end}}{{quote $f.Column}}{{end}}:
+		default:
+			return nil, fmt.Errorf("%s: unknown column %q", {{quote .Table}}, col)
+		}
+	}
+	{{- end}}
+
+	structs := make([]{{.TypeName}}, 0, 16)
+	for rs.Next() {
+		var s {{.TypeName}}
+		{{- template "temps" .}}
+		dests := make([]interface{}, len(cols))
+		{{- if eq (opts).UnknownColumns "extra"}}
+		extra := make(map[string]*interface{})
+		{{- end}}
+		for i, col := range cols {
+			switch col {
+			{{- range $i, $f := .Fields}}
+			case {{quote $f.Column}}:
+				dests[i] = {{$f.Dest $i}}
+			{{- end}}
+			{{- if eq (opts).UnknownColumns "ignore"}}
+			default:
+				dests[i] = new(interface{})
+			{{- else if eq (opts).UnknownColumns "extra"}}
+			default:
+				v := new(interface{})
+				dests[i] = v
+				extra[col] = v
+			{{- end}}
+			}
+		}
+		if err = rs.Scan(dests...); err != nil {
+			return nil, err
+		}
+		{{- template "assigns" .}}
+		{{- if eq (opts).UnknownColumns "extra"}}
+		s.{{.Extra.Name}} = make({{.Extra.Type}}, len(extra))
+		for col, v := range extra {
+			s.{{.Extra.Name}}[col] = *v
+		}
+		{{- end}}
+		{{- afterScan . "context.Background()" "nil, err"}}
+		{{- template "maxRows" .}}
+		structs = append(structs, s)
+	}
+	if err = rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+{{end}}
+
+{{define "rowTo"}}
+// {{name "rowTo" .Name}} scans a row for pgx.CollectRows and pgx.CollectOneRow.
+func {{name "rowTo" .Name}}(row pgx.CollectableRow) ({{.TypeName}}, error) {
+	return {{name "scan" .Name}}(row)
+}
+{{end}}
+
+{{define "scanMap"}}
+func {{name "scan" (print .Name "s") "map"}}(rs {{(driver).Rows}}) (map[{{.PK.QualType}}]{{.TypeName}}, error) {
+	structs := make(map[{{.PK.QualType}}]{{.TypeName}})
+	for rs.Next() {
+		var s {{.TypeName}}
+		if err := {{name "scan" .Name "into"}}(rs, &s); err != nil {
+			return nil, err
+		}
+		{{- template "maxRows" .}}
+		structs[s.{{.PK.Name}}] = s
+	}
+	if err := rs.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+{{end}}
+
+{{define "stream"}}
+func {{name "stream" (print .Name "s")}}(ctx context.Context, rs {{(driver).Rows}}, ch chan<- {{.TypeName}}) error {
+	for rs.Next() {
+		var s {{.TypeName}}
+		if err := {{name "scan" .Name "into"}}(rs, &s); err != nil {
+			return err
+		}
+		select {
+		case ch <- s:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return rs.Err()
+}
+
+func {{name "forEach" .Name}}(rs {{(driver).Rows}}, fn func({{.TypeName}}) error) error {
+	for rs.Next() {
+		var s {{.TypeName}}
+		if err := {{name "scan" .Name "into"}}(rs, &s); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rs.Err()
+}
+{{end}}
+
+{{define "iter"}}
+func {{name "iter" (print .Name "s")}}(rs {{(driver).Rows}}) iter.Seq2[{{.TypeName}}, error] {
+	return func(yield func({{.TypeName}}, error) bool) {
+		for rs.Next() {
+			var s {{.TypeName}}
+			if err := {{name "scan" .Name "into"}}(rs, &s); err != nil {
+				yield({{.TypeName}}{}, err)
+				return
+			}
+			if !yield(s, nil) {
+				return
+			}
+		}
+		if err := rs.Err(); err != nil {
+			yield({{.TypeName}}{}, err)
+		}
+	}
+}
+{{end}}
+
+{{define "temps"}}{{range $i, $f := .Fields}}{{if $f.Strategy.Temp}}
+	var {{$f.Temp $i}} {{$f.Strategy.Temp}}{{end}}{{end}}{{end}}
+
+{{define "dests"}}{{range $i, $f := .Fields}}
+		{{$f.Dest $i}},{{end}}{{end}}
+
+{{define "assigns"}}{{range $i, $f := .Fields}}{{if $f.Strategy.Temp}}
+	s.{{$f.Name}} = {{$f.Convert $i}}{{end}}{{end}}{{end}}
+
+{{define "timeout"}}{{with .}}
+	ctx, cancel := context.WithTimeout(ctx, {{.}})
+	defer cancel()
+{{end}}{{end}}
+
+{{define "checkCtx"}}{{with (opts).CheckRows}}
+		if len(structs)%{{.}} == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}{{end}}{{end}}
+
+{{define "scanRows"}}
+	{{- if (opts).CheckRows}}{{name "scan" (print .Name "s") "context"}}(ctx, rows)
+	{{- else}}{{name "scan" (print .Name "s")}}(rows){{end}}{{end}}
+
+{{define "maxRows"}}{{with (opts).MaxRows}}
+		if len(structs) == {{.}} {
+			return nil, &{{name "TooManyRowsError"}}{Table: {{quote $.Table}}, Max: {{.}}}
+		}{{end}}{{end}}`
+
+	rowScannerText = `{{define "rowScanner"}}
+// {{name "RowScanner"}} is implemented by {{(driver).Row}}.
+type {{name "RowScanner"}} interface {
+	Scan(dest ...interface{}) error
+}
+{{end}}`
+
+	dbtxText = `{{define "dbtx"}}
+// {{name "DBTX"}} is implemented by {{(driver).Conns}}.
+type {{name "DBTX"}} interface {
+	{{- if pgx}}
+	Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row
+	{{- else if sqlx}}
+	sqlx.ExtContext
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	{{- else}}
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	{{- end}}
+}
+{{end}}
+
+{{define "txBeginner"}}
+{{- if pgx}}
+// {{name "TxBeginner"}} is implemented by *pgx.Conn, *pgxpool.Pool and
+// pgx.Tx.
+type {{name "TxBeginner"}} interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+{{- else if sqlx}}
+// {{name "TxBeginner"}} is implemented by *sqlx.DB.
+type {{name "TxBeginner"}} interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+{{- else}}
+// {{name "TxBeginner"}} is implemented by *sql.DB and *sql.Conn.
+type {{name "TxBeginner"}} interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+{{- end}}
+{{if (opts).RetryTx}}
+// isSerializationFailure reports whether err has SQLSTATE 40001, after
+// which CockroachDB expects transactions to be retried. pgx and pq errors
+// report their SQLSTATE.
+func isSerializationFailure(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == "40001"
+}
+{{end}}{{end}}`
+
+	notFoundText = `{{define "notFound"}}
+// {{name "NotFoundError"}} is returned when no row matches a lookup. It
+// wraps {{(driver).ErrNoRows}}.
+type {{name "NotFoundError"}} struct {
+	Table string
+	Key   interface{}
+}
+
+func (e *{{name "NotFoundError"}}) Error() string {
+	return fmt.Sprintf("%s: no row for key %v", e.Table, e.Key)
+}
+
+func (e *{{name "NotFoundError"}}) Unwrap() error {
+	return {{(driver).ErrNoRows}}
+}
+{{end}}`
+
+	tooManyRowsText = `{{define "tooManyRows"}}
+// {{name "TooManyRowsError"}} is returned when a query returns more rows
+// than plural scan functions accept.
+type {{name "TooManyRowsError"}} struct {
+	Table string
+	Max   int
+}
+
+func (e *{{name "TooManyRowsError"}}) Error() string {
+	return fmt.Sprintf("%s: query returned more than %d rows", e.Table, e.Max)
+}
+{{end}}`
+
+	conflictText = `{{define "conflict"}}
+// {{name "ConflictError"}} is returned when updating a versioned row that
+// was changed or deleted since it was read.
+type {{name "ConflictError"}} struct {
+	Table   string
+	Key     interface{}
+	Version interface{}
+}
+
+func (e *{{name "ConflictError"}}) Error() string {
+	return fmt.Sprintf("%s: row for key %v changed since version %v", e.Table, e.Key, e.Version)
+}
+{{end}}`
+
+	otelText = `{{define "otel"}}
+// {{name "Tracer"}} starts the spans of generated functions querying the
+// database.
+var {{name "Tracer"}} = otel.Tracer("scaneo")
+
+// endSpan records err, or rows unless negative, on span and ends it.
+func endSpan(span trace.Span, err error, rows int) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if rows >= 0 {
+		span.SetAttributes(attribute.Int("db.rows", rows))
+	}
+	span.End()
+}
+{{end}}`
+
+	queryLoggerText = `{{define "queryLogger"}}
+// {{name "QueryLogger"}}, when set, is called after generated functions run a
+// query, with the query, its arguments, how long it took and its error.
+var {{name "QueryLogger"}} func(ctx context.Context, query string, args []interface{}, d time.Duration, err error)
+
+// loggedDB calls {{name "QueryLogger"}} after the queries it runs on DBTX.
+type loggedDB struct {
+	{{name "DBTX"}}
+}
+
+// logged returns db, logging its queries when {{name "QueryLogger"}} is set.
+// Repositories wrap their DBTX once, so set it before creating them.
+func logged(db {{name "DBTX"}}) {{name "DBTX"}} {
+	if {{name "QueryLogger"}} == nil {
+		return db
+	}
+	return loggedDB{db}
+}
+{{if pgx}}
+func (db loggedDB) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := db.{{name "DBTX"}}.Exec(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), err)
+	return tag, err
+}
+
+func (db loggedDB) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	start := time.Now()
+	rows, err := db.{{name "DBTX"}}.Query(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), err)
+	return rows, err
+}
+
+func (db loggedDB) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	return loggedRow{db.{{name "DBTX"}}.QueryRow(ctx, query, args...), ctx, query, args, time.Now()}
+}
+
+// loggedRow logs its query once scanned, when pgx reports its error.
+type loggedRow struct {
+	row   pgx.Row
+	ctx   context.Context
+	query string
+	args  []interface{}
+	start time.Time
+}
+
+func (r loggedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	{{name "QueryLogger"}}(r.ctx, r.query, r.args, time.Since(r.start), err)
+	return err
+}
+{{- else}}
+func (db loggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.{{name "DBTX"}}.ExecContext(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), err)
+	return res, err
+}
+
+func (db loggedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.{{name "DBTX"}}.QueryContext(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), err)
+	return rows, err
+}
+{{- if sqlx}}
+
+func (db loggedDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := db.{{name "DBTX"}}.QueryxContext(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), err)
+	return rows, err
+}
+
+func (db loggedDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	start := time.Now()
+	row := db.{{name "DBTX"}}.QueryRowxContext(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), row.Err())
+	return row
+}
+{{- else}}
+
+func (db loggedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := db.{{name "DBTX"}}.QueryRowContext(ctx, query, args...)
+	{{name "QueryLogger"}}(ctx, query, args, time.Since(start), row.Err())
+	return row
+}
+{{- end}}
+{{- end}}
+{{end}}
+
+{{define "logged"}}{{if (opts).LogQueries}}
+	db = logged(db)
+{{- end}}{{end}}`
+
+	auditText = `{{define "auditFunc"}}
+// {{name "AuditFunc"}}, when set, is called after generated functions
+// write a row, with the table, the operation, insert, upsert, update or
+// delete, and the primary key of the row.
+var {{name "AuditFunc"}} func(ctx context.Context, table, op string, pk interface{})
+{{end}}`
+
+	noRowsAffectedText = `{{define "noRowsAffected"}}
+// {{name "ErrNoRowsAffected"}} is returned by updates and deletes that
+// matched no row.
+var {{name "ErrNoRowsAffected"}} = errors.New("no rows affected")
+{{end}}`
+
+	getText = `{{define "get"}}
+func {{name "get" .Name}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}) {{template "oneResult" .TypeName}} {
+	{{- span . "get" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	s, err := {{name "scan" .Name}}(db.{{(driver).QueryRow}}(ctx, {{name "select" .Name}}+{{quote (print " WHERE " (equals .PK 1) (live . " AND "))}}, {{.PK.Param}}))
+	if err == {{(driver).ErrNoRows}} {
+		return s, &{{name "NotFoundError"}}{Table: {{quote .Table}}, Key: {{.PK.Param}}}
+	}
+	return s, err
+}
+{{if .DeletedAt}}
+func {{name "get" .Name "including" "deleted"}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}) {{template "oneResult" .TypeName}} {
+	{{- span . "getIncludingDeleted" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	s, err := {{name "scan" .Name}}(db.{{(driver).QueryRow}}(ctx, {{name "select" .Name}}+{{quote (print " WHERE " (equals .PK 1))}}, {{.PK.Param}}))
+	if err == {{(driver).ErrNoRows}} {
+		return s, &{{name "NotFoundError"}}{Table: {{quote .Table}}, Key: {{.PK.Param}}}
+	}
+	return s, err
+}
+{{end}}{{end}}`
+
+	findText = `{{define "find"}}{{$tok := .}}{{range .Fields}}{{if .Unique}}
+func {{name "find" $tok.Name "by" .Name}}(ctx context.Context, db {{name "DBTX"}}, {{.Param}} {{.QualType}}) {{template "oneResult" $tok.TypeName}} {
+	{{- span $tok (print "findBy" .Name) ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	s, err := {{name "scan" $tok.Name}}(db.{{(driver).QueryRow}}(ctx, {{name "select" $tok.Name}}+{{quote (print " WHERE " (equals . 1))}}, {{.Param}}))
+	if err == {{(driver).ErrNoRows}} {
+		return s, &{{name "NotFoundError"}}{Table: {{quote $tok.Table}}, Key: {{.Param}}}
+	}
+	return s, err
+}
+{{else if .CaseInsensitive}}
+func {{name "find" (print $tok.Name "s") "by" .Name}}(ctx context.Context, db {{name "DBTX"}}, {{.Param}} {{.QualType}}) {{template "manyResult" $tok.TypeName}} {
+	{{- span $tok (print "findBy" .Name) "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	rows, err := db.{{(driver).Query}}(ctx, {{name "select" $tok.Name}}+{{quote (print " WHERE " (equals . 1))}}, {{.Param}})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return {{template "scanRows" $tok}}
+}
+{{end}}{{end}}{{end}}`
+
+	searchText = `{{define "search"}}
+func {{name "search" (print .Name "s")}}(ctx context.Context, db {{name "DBTX"}}, query string, limit int) {{template "manyResult" .TypeName}} {
+	{{- span . "search" "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	rows, err := db.{{(driver).Query}}(ctx, {{quote (search .)}}, {{searchArgs .}})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	{{- if .Rank}}
+
+	structs := make([]{{.TypeName}}, 0, 16)
+	for rows.Next() {
+		{{- template "checkCtx"}}
+		var s {{.TypeName}}
+		{{- template "temps" .}}
+		if err = rows.Scan({{template "dests" .}}
+			&s.{{.Rank.Name}},
+		); err != nil {
+			return nil, err
+		}
+		{{- template "assigns" .}}
+		{{- afterScan . "ctx" "nil, err"}}
+		{{- template "maxRows" .}}
+		structs = append(structs, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+	{{- else}}
+	return {{template "scanRows" .}}
+	{{- end}}
+}
+{{end}}`
+
+	squirrelText = `{{define "squirrel"}}
+func {{name .Name "selectBuilder"}}() squirrel.SelectBuilder {
+	return squirrel.Select({{columnList .}}).From({{quote (ident .Table)}}){{with placeholderFormat}}.PlaceholderFormat(squirrel.{{.}}){{end}}
+}
+{{end}}`
+
+	listText = `{{define "list"}}
+func {{name "list" .Name}}(ctx context.Context, db {{name "DBTX"}}, limit, offset int) {{template "manyResult" .TypeName}} {
+	{{- span . "list" "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	rows, err := db.{{(driver).Query}}(ctx, {{name "select" .Name}}+{{quote (print (live . " WHERE ") (paginate .PK.Column 1 2))}}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return {{template "scanRows" .}}
+}
+{{if .DeletedAt}}
+func {{name "list" .Name "including" "deleted"}}(ctx context.Context, db {{name "DBTX"}}, limit, offset int) {{template "manyResult" .TypeName}} {
+	{{- span . "listIncludingDeleted" "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	rows, err := db.{{(driver).Query}}(ctx, {{name "select" .Name}}+{{quote (paginate .PK.Column 1 2)}}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return {{template "scanRows" .}}
+}
+{{end}}
+func {{name "list" .Name "after"}}(ctx context.Context, db {{name "DBTX"}}, cursor {{.PK.QualType}}, limit int) {{template "manyResult" .TypeName}} {
+	{{- span . "listAfter" "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	rows, err := db.{{(driver).Query}}(ctx, {{name "select" .Name}}+{{quote (print " WHERE " (ident .PK.Column) " > " (ph 1) (live . " AND ") (paginate .PK.Column 2 0))}}, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return {{template "scanRows" .}}
+}
+
+func {{name "encode" .Name "cursor"}}(x {{.TypeName}}) string {
+	b, _ := json.Marshal(x.{{.PK.Name}}) // primary keys always marshal
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func {{name "decode" .Name "cursor"}}(s string) ({{.PK.QualType}}, error) {
+	var cursor {{.PK.QualType}}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, fmt.Errorf("%s: invalid cursor: %s", {{quote .Table}}, err)
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return cursor, fmt.Errorf("%s: invalid cursor: %s", {{quote .Table}}, err)
+	}
+	return cursor, nil
+}
+{{end}}`
+
+	countText = `{{define "count"}}
+func {{name "count" .Name}}(ctx context.Context, db {{name "DBTX"}}, where string, args ...interface{}) {{template "oneResult" "int64"}} {
+	{{- span . "count" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	query := {{quote (print "SELECT COUNT(*) FROM " (ident .Table))}}
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	var n int64
+	if err := db.{{(driver).QueryRow}}(ctx, query, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+{{end}}
+
+{{define "exists"}}
+func {{name "exists" .Name "byPK"}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}) {{template "oneResult" "bool"}} {
+	{{- span . "exists" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	{{- template "logged"}}
+	var exists bool
+	if err := db.{{(driver).QueryRow}}(ctx, {{quote (exists (printf "SELECT 1 FROM %s WHERE %s" (ident .Table) (equals .PK 1)))}}, {{.PK.Param}}).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+{{end}}`
+
+	insertText = `{{define "insert"}}
+func {{name "insert" .Name}}(ctx context.Context, db {{name "DBTX"}}, x *{{.TypeName}}) {{template "errResult"}} {
+	{{- span . "insert" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "insert" "x"}}
+	{{- template "beforeInsert" .}}
+	{{- validate . "err"}}
+	{{- if sqlx}}
+	{{template "insertResult" .}} {{if returning .}}namedQueryRow{{else}}sqlx.NamedExecContext{{end}}(ctx, db, {{quote (namedCreateSQL .)}}, {{name .Name "argMap"}}(*x)){{template "insertReturn" .}}
+	{{- else}}
+	{{template "insertResult" .}} db.{{template "insertMethod" .}}(ctx, {{quote (createSQL .)}},{{template "insertArgs" .}}
+	){{template "insertReturn" .}}
+	{{- end}}
+}
+{{end}}
+
+{{define "namedQueryRow"}}
+// namedQueryRow queries a row with :name parameters bound from arg.
+func namedQueryRow(ctx context.Context, db {{name "DBTX"}}, query string, arg interface{}) {{name "RowScanner"}} {
+	query, args, err := db.BindNamed(query, arg)
+	if err != nil {
+		return errRow{err}
+	}
+	return db.QueryRowxContext(ctx, query, args...)
+}
+
+// errRow is a row failing to scan with err.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+{{end}}
+
+{{define "beforeInsert"}}{{if .Hooks.BeforeInsert}}
+	if err := x.BeforeInsert(ctx); err != nil {
+		return err
+	}
+{{end}}{{end}}
+
+{{define "insertArgs"}}{{range .Fields}}{{if not (and .PK .Auto)}}
+		{{.Arg "x"}},{{end}}{{end}}{{if returningInto .}}
+		sql.Out{Dest: &x.{{.PK.Name}}},{{end}}{{end}}
+
+{{define "insertResult"}}{{if returning .}}return{{else if lastInsertID .}}res, err :={{else}}{{template "discard"}}{{end}}{{end}}
+
+{{define "insertMethod"}}{{if returning .}}{{(driver).QueryRow}}{{else}}{{(driver).Exec}}{{end}}{{end}}
+
+{{define "insertReturn"}}{{if returning .}}.Scan(&x.{{.PK.Name}}){{else if lastInsertID .}}
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	x.{{.PK.Name}} = {{.PK.QualType}}(id)
+	return nil
+	{{- else}}
+	return err{{end}}{{end}}`
+
+	upsertText = `{{define "upsert"}}
+func {{name "upsert" .Name}}(ctx context.Context, db {{name "DBTX"}}, x {{.TypeName}}) {{template "errResult"}} {
+	{{- span . "upsert" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "upsert" "x"}}
+	{{- template "beforeInsert" .}}
+	{{- validate . "err"}}
+	{{- if sqlx}}
+	{{template "discard"}} sqlx.NamedExecContext(ctx, db, {{quote (namedUpsertSQL .)}}, {{name .Name "argMap"}}(x))
+	{{- else}}
+	{{template "discard"}} db.{{(driver).Exec}}(ctx, {{quote (upsertSQL .)}},{{range .Fields}}
+		{{.Arg "x"}},{{end}}
+	)
+	{{- end}}
+	return err
+}
+{{end}}`
+
+	updateText = `{{define "update"}}
+func {{name "update" .Name}}(ctx context.Context, db {{name "DBTX"}}, x {{template "updateParam" .}}) {{template "errResult"}} {
+	{{- span . "update" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "update" "x"}}
+	{{- validate . "err"}}
+	{{- if sqlx}}
+	{{template "updateResult" .}} sqlx.NamedExecContext(ctx, db, {{quote (namedUpdateSQL .)}}, {{name .Name "argMap"}}({{if .VersionField}}*{{end}}x))
+	{{- else}}
+	{{template "updateResult" .}} db.{{(driver).Exec}}(ctx, {{quote (updateSQL .)}},{{template "updateArgs" .}}
+	)
+	{{- end}}
+	{{- template "updateReturn" .}}
+}
+
+{{if not .VersionField}}
+func {{name "update" .Name "affected"}}(ctx context.Context, db {{name "DBTX"}}, x {{.TypeName}}) {{template "countResult"}} {
+	{{- span . "updateAffected" "int(n)"}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "update" "x"}}
+	{{- validate . "0, err"}}
+	{{- if sqlx}}
+	res, err := sqlx.NamedExecContext(ctx, db, {{quote (namedUpdateSQL .)}}, {{name .Name "argMap"}}(x))
+	{{- else}}
+	res, err := db.{{(driver).Exec}}(ctx, {{quote (updateSQL .)}},{{template "updateArgs" .}}
+	)
+	{{- end}}
+	if err != nil {
+		return 0, err
+	}
+	{{- template "returnAffected"}}
+}
+{{end}}
+func {{name "update" .Name "fields"}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}, fields map[string]interface{}) {{template "errResult"}} {
+	{{- span . "updateFields" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	cols := make([]string, 0, len(fields))
+	for col := range fields {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	{{if numbered}}args := []interface{}{ {{- .PK.Param -}} }{{else}}args := make([]interface{}, 0, len(cols)+1){{end}}
+	sets := make([]string, len(cols))
+	for i, col := range cols {
+		value := fields[col]
+		var set string
+		switch col {
+		{{- range .Fields}}{{if not (or .PK .Version)}}
+		case {{quote .Column}}:
+			set = {{quote (setFormat .)}}
+			{{- if and .Strategy.Value (not .Sub)}}
+			if v, ok := value.({{.QualType}}); ok {
+				value = {{printf .Strategy.Value "v"}}
+			}
+			{{- end}}
+		{{- end}}{{end}}
+		default:
+			return fmt.Errorf("%s: can't update column %q", {{quote .Table}}, col)
+		}
+		args = append(args, value)
+		sets[i] = fmt.Sprintf(set, {{phExpr "len(args)"}})
+	}
+	{{- with .VersionField}}
+	sets = append(sets, {{quote (print (ident .Column) " = " (ident .Column) " + 1")}})
+	{{- end}}
+	{{- if not numbered}}
+	args = append(args, {{.PK.Param}})
+	{{- end}}
+	{{- audit . "update" .PK.Param}}
+	{{template "execResult"}} db.{{(driver).Exec}}(ctx, {{quote (print "UPDATE " (ident .Table) " SET ")}}+strings.Join(sets, ", ")+{{quote (print " WHERE " (equals .PK 1))}}, args...)
+	{{- template "execReturn"}}
+}
+
+func {{name .Name "changedColumns"}}(old, new {{.TypeName}}) ([]string, []interface{}) {
+	var cols []string
+	var values []interface{}
+	{{- range .Fields}}{{if not (or .PK .Version)}}
+	if {{changed .}} {
+		cols = append(cols, {{quote .Column}})
+		values = append(values, new.{{.Name}})
+	}
+	{{- end}}{{end}}
+	return cols, values
+}
+{{end}}
+
+{{define "delete"}}
+func {{name "delete" .Name}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}) {{template "errResult"}} {
+	{{- span . "delete" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "delete" .PK.Param}}
+	{{template "execResult"}} db.{{(driver).Exec}}(ctx, {{quote (deleteSQL .)}}, {{.PK.Param}})
+	{{- template "execReturn"}}
+}
+
+func {{name "delete" .Name "affected"}}(ctx context.Context, db {{name "DBTX"}}, {{.PK.Param}} {{.PK.QualType}}) {{template "countResult"}} {
+	{{- span . "deleteAffected" "int(n)"}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	{{- audit . "delete" .PK.Param}}
+	res, err := db.{{(driver).Exec}}(ctx, {{quote (deleteSQL .)}}, {{.PK.Param}})
+	if err != nil {
+		return 0, err
+	}
+	{{- template "returnAffected"}}
+}
+{{end}}
+
+{{define "rowsAffected"}}{{if pgx}}
+	n := res.RowsAffected()
+{{- else}}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+{{- end}}{{end}}
+
+{{define "returnAffected"}}{{if pgx}}
+	return res.RowsAffected(), nil
+{{- else}}
+	return res.RowsAffected()
+{{- end}}{{end}}
+
+{{define "execResult"}}{{if (opts).Strict}}res, err :={{else}}{{template "discard"}}{{end}}{{end}}
+
+{{define "errResult"}}{{if namedResults}}(err error){{else}}error{{end}}{{end}}
+
+{{define "countResult"}}{{if namedResults}}(n int64, err error){{else}}(int64, error){{end}}{{end}}
+
+{{define "oneResult"}}{{if namedResults}}(_ {{.}}, err error){{else}}({{.}}, error){{end}}{{end}}
+
+{{define "manyResult"}}{{if namedResults}}(found []{{.}}, err error){{else}}([]{{.}}, error){{end}}{{end}}
+
+{{define "discard"}}_, err {{if namedResults}}={{else}}:={{end}}{{end}}
+
+{{define "execReturn"}}{{if (opts).Strict}}
+	if err != nil {
+		return err
+	}
+	{{- template "rowsAffected"}}
+	if n == 0 {
+		return {{name "ErrNoRowsAffected"}}
+	}
+	return nil
+{{- else}}
+	return err
+{{- end}}{{end}}
+
+{{define "updateParam"}}{{if .VersionField}}*{{end}}{{.TypeName}}{{end}}
+
+{{define "updateArgs"}}{{range .Fields}}{{if not (or .PK .Version)}}
+		{{.Arg "x"}},{{end}}{{end}}
+		{{.PK.Arg "x"}},{{with .VersionField}}
+		{{.Arg "x"}},{{end}}{{end}}
+
+{{define "updateResult"}}{{if .VersionField}}res, err :={{else}}{{template "execResult"}}{{end}}{{end}}
+
+{{define "updateReturn"}}{{with .VersionField}}
+	if err != nil {
+		return err
+	}
+	{{- template "rowsAffected"}}
+	if n == 0 {
+		return &{{name "ConflictError"}}{Table: {{quote $.Table}}, Key: x.{{$.PK.Name}}, Version: x.{{.Name}}}
+	}
+	x.{{.Name}}++
+	return nil
+{{- else}}{{template "execReturn"}}{{end}}{{end}}`
+
+	batchText = `{{define "batchPreparer"}}
+// {{name "BatchPreparer"}} prepares clickhouse-go batches. Connections
+// opened with clickhouse.Open implement it.
+type {{name "BatchPreparer"}} interface {
+	PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error)
+}
+{{end}}
+
+{{define "batch"}}{{if prepareBatch}}
+func {{name "insert" .Name "Batch"}}(ctx context.Context, conn {{name "BatchPreparer"}}, xs []{{.TypeName}}) {{template "errResult"}} {
+	{{- span . "insertBatch" "len(xs)"}}
+	{{- template "timeout" (timeout $ "write")}}
+	batch, err := conn.PrepareBatch(ctx, {{quote (insertBatch .)}})
+	if err != nil {
+		return err
+	}
+	for _, x := range xs {
+		if err := batch.Append({{range $i, $f := createFields .}}{{if $i}}, {{end}}{{$f.Arg "x"}}{{end}}); err != nil {
+			batch.Abort()
+			return err
+		}
+	}
+	return batch.Send()
+}
+{{else}}
+func {{name "insert" .Name "Batch"}}(ctx context.Context, db {{name "DBTX"}}, xs []{{.TypeName}}) {{template "errResult"}} {
+	{{- span . "insertBatch" "len(xs)"}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- template "logged"}}
+	const rowsPerInsert = {{rowsPerInsert .}}
+	rest := xs
+	for len(rest) > 0 {
+		n := len(rest)
+		if n > rowsPerInsert {
+			n = rowsPerInsert
+		}
+
+		var b strings.Builder
+		b.WriteString({{quote (insertInto .)}})
+		args := make([]interface{}, 0, n*{{len (createFields .)}})
+		for i, x := range rest[:n] {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			{{- if numbered}}
+			p := len(args)
+			{{- end}}
+			{{batchRow .}}
+			args = append(args,{{range createFields .}}
+				{{.Arg "x"}},{{end}}
+			)
+		}
+
+		if _, err := db.{{(driver).Exec}}(ctx, b.String(), args...); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+	return nil
+}
+{{end}}{{end}}`
+
+	copyText = `{{define "copier"}}
+// {{name "Copier"}} copies rows with the postgres COPY protocol. pgx
+// connections, pools and transactions implement it.
+type {{name "Copier"}} interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+{{end}}
+
+{{define "copy"}}
+// {{lower .Name}}CopySource implements pgx.CopyFromSource over {{.Table}} rows.
+type {{lower .Name}}CopySource struct {
+	xs []{{.TypeName}}
+	i  int
+}
+
+func (s *{{lower .Name}}CopySource) Next() bool {
+	s.i++
+	return s.i <= len(s.xs)
+}
+
+func (s *{{lower .Name}}CopySource) Values() ([]interface{}, error) {
+	x := s.xs[s.i-1]
+	return []interface{}{ {{- range $i, $f := createFields .}}{{if $i}}, {{end}}{{$f.Arg "x"}}{{end -}} }, nil
+}
+
+func (s *{{lower .Name}}CopySource) Err() error {
+	return nil
+}
+
+func {{name "copy" (print .Name "s")}}(ctx context.Context, conn {{name "Copier"}}, xs []{{.TypeName}}) {{template "countResult"}} {
+	{{- span . "copy" "int(n)"}}
+	{{- template "timeout" (timeout $ "write")}}
+	return conn.CopyFrom(ctx, {{identifier .Table}}, []string{ {{- range $i, $f := createFields .}}{{if $i}}, {{end}}{{quote $f.Column}}{{end -}} }, &{{lower .Name}}CopySource{xs: xs})
+}
+{{end}}`
+
+	queueText = `{{define "queue"}}{{if .PK}}
+func {{name "queue" "get" .Name}}(b *pgx.Batch, {{.PK.Param}} {{.PK.QualType}}, dst *{{.TypeName}}) {
+	b.Queue({{name "select" .Name}}+{{quote (print " WHERE " (equals .PK 1) (live . " AND "))}}, {{.PK.Param}}).QueryRow(func(row pgx.Row) error {
+		s, err := {{name "scan" .Name}}(row)
+		if err == pgx.ErrNoRows {
+			return &{{name "NotFoundError"}}{Table: {{quote .Table}}, Key: {{.PK.Param}}}
+		}
+		*dst = s
+		return err
+	})
+}
+{{end}}
+func {{name "queue" "select" (print .Name "s")}}(b *pgx.Batch, dst *[]{{.TypeName}}, where string, args ...interface{}) {
+	query := {{name "select" .Name}}
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	b.Queue(query, args...).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			s, err := {{name "scan" .Name}}(rows)
+			if err != nil {
+				return err
+			}
+			*dst = append(*dst, s)
+		}
+		return rows.Err()
+	})
+}
+{{end}}`
+
+	prepareText = `{{define "prepare"}}
+// {{name .Name "statements"}} holds prepared statements for {{.Table}} rows.
+type {{name .Name "statements"}} struct {
+	getStmt    *sql.Stmt
+	insertStmt *sql.Stmt
+	updateStmt *sql.Stmt
+	deleteStmt *sql.Stmt
+}
+
+func {{name "prepare" .Name "statements"}}(ctx context.Context, db {{name "DBTX"}}) (*{{name .Name "statements"}}, error) {
+	var st {{name .Name "statements"}}
+	var err error
+	if st.getStmt, err = db.PrepareContext(ctx, {{name "select" .Name}}+{{quote (print " WHERE " (equals .PK 1) (live . " AND "))}}); err != nil {
+		st.Close()
+		return nil, err
+	}
+	if st.insertStmt, err = db.PrepareContext(ctx, {{quote (createSQL .)}}); err != nil {
+		st.Close()
+		return nil, err
+	}
+	if st.updateStmt, err = db.PrepareContext(ctx, {{quote (updateSQL .)}}); err != nil {
+		st.Close()
+		return nil, err
+	}
+	if st.deleteStmt, err = db.PrepareContext(ctx, {{quote (deleteSQL .)}}); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (st *{{name .Name "statements"}}) Close() error {
+	var first error
+	for _, stmt := range []*sql.Stmt{st.getStmt, st.insertStmt, st.updateStmt, st.deleteStmt} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (st *{{name .Name "statements"}}) {{name "get"}}(ctx context.Context, {{.PK.Param}} {{.PK.QualType}}) {{template "oneResult" .TypeName}} {
+	{{- span . "get" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	s, err := {{name "scan" .Name}}(st.getStmt.QueryRowContext(ctx, {{.PK.Param}}))
+	if err == {{(driver).ErrNoRows}} {
+		return s, &{{name "NotFoundError"}}{Table: {{quote .Table}}, Key: {{.PK.Param}}}
+	}
+	return s, err
+}
+
+func (st *{{name .Name "statements"}}) {{name "insert"}}(ctx context.Context, x *{{.TypeName}}) {{template "errResult"}} {
+	{{- span . "insert" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "insert" "x"}}
+	{{- template "beforeInsert" .}}
+	{{- validate . "err"}}
+	{{template "insertResult" .}} st.insertStmt.{{if returning .}}QueryRowContext{{else}}ExecContext{{end}}(ctx,{{template "insertArgs" .}}
+	){{template "insertReturn" .}}
+}
+
+func (st *{{name .Name "statements"}}) {{name "update"}}(ctx context.Context, x {{template "updateParam" .}}) {{template "errResult"}} {
+	{{- span . "update" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "update" "x"}}
+	{{- validate . "err"}}
+	{{template "updateResult" .}} st.updateStmt.ExecContext(ctx,{{template "updateArgs" .}}
+	)
+	{{- template "updateReturn" .}}
+}
+
+func (st *{{name .Name "statements"}}) {{name "delete"}}(ctx context.Context, {{.PK.Param}} {{.PK.QualType}}) {{template "errResult"}} {
+	{{- span . "delete" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "delete" .PK.Param}}
+	{{template "execResult"}} st.deleteStmt.ExecContext(ctx, {{.PK.Param}})
+	{{- template "execReturn"}}
+}
+{{end}}`
+
+	repoText = `{{define "repo"}}
+// {{name .Name "repo"}} reads and writes {{.Table}} rows.
+type {{name .Name "repo"}} struct {
+	db {{name "DBTX"}}
+}
+
+func {{name "new" .Name "repo"}}(db {{name "DBTX"}}) *{{name .Name "repo"}} {
+	return &{{name .Name "repo"}}{db: {{if (opts).LogQueries}}logged(db){{else}}db{{end}}}
+}
+
+func {{name "with" .Name "tx"}}(ctx context.Context, db {{name "TxBeginner"}}, fn func(*{{name .Name "repo"}}) error) error {
+	{{- if (opts).RetryTx}}
+	for retries := 0; ; retries++ {
+		err := func() error {
+	{{- end}}
+	tx, err := db.{{if pgx}}Begin(ctx){{else if sqlx}}BeginTxx(ctx, nil){{else}}BeginTx(ctx, nil){{end}}
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback({{if pgx}}ctx{{end}}) // no-op once committed
+
+	if err := fn({{name "new" .Name "repo"}}(tx)); err != nil {
+		return err
+	}
+	return tx.Commit({{if pgx}}ctx{{end}})
+	{{- if (opts).RetryTx}}
+		}()
+		if retries == {{(opts).RetryTx}} || !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(1<<retries) * 10 * time.Millisecond):
+		}
+	}
+	{{- end}}
+}
+
+func (r *{{name .Name "repo"}}) {{name "get"}}(ctx context.Context, {{.PK.Param}} {{.PK.QualType}}) {{template "oneResult" .TypeName}} {
+	{{- span . "get" ""}}
+	{{- template "timeout" (timeout $ "read")}}
+	s, err := {{name "scan" .Name}}(r.db.{{(driver).QueryRow}}(ctx, {{name "select" .Name}}+{{quote (print " WHERE " (equals .PK 1) (live . " AND "))}}, {{.PK.Param}}))
+	if err == {{(driver).ErrNoRows}} {
+		return s, &{{name "NotFoundError"}}{Table: {{quote .Table}}, Key: {{.PK.Param}}}
+	}
+	return s, err
+}
+
+func (r *{{name .Name "repo"}}) {{name "list"}}(ctx context.Context, limit, offset int) {{template "manyResult" .TypeName}} {
+	{{- span . "list" "len(found)"}}
+	{{- template "timeout" (timeout $ "read")}}
+	rows, err := r.db.{{(driver).Query}}(ctx, {{name "select" .Name}}+{{quote (print (live . " WHERE ") (paginate .PK.Column 1 2))}}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return {{template "scanRows" .}}
+}
+
+func (r *{{name .Name "repo"}}) {{name "insert"}}(ctx context.Context, x *{{.TypeName}}) {{template "errResult"}} {
+	{{- span . "insert" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "insert" "x"}}
+	{{- template "beforeInsert" .}}
+	{{- validate . "err"}}
+	{{template "insertResult" .}} r.db.{{template "insertMethod" .}}(ctx, {{quote (createSQL .)}},{{template "insertArgs" .}}
+	){{template "insertReturn" .}}
+}
+
+func (r *{{name .Name "repo"}}) {{name "update"}}(ctx context.Context, x {{template "updateParam" .}}) {{template "errResult"}} {
+	{{- span . "update" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "update" "x"}}
+	{{- validate . "err"}}
+	{{template "updateResult" .}} r.db.{{(driver).Exec}}(ctx, {{quote (updateSQL .)}},{{template "updateArgs" .}}
+	)
+	{{- template "updateReturn" .}}
+}
+
+func (r *{{name .Name "repo"}}) {{name "delete"}}(ctx context.Context, {{.PK.Param}} {{.PK.QualType}}) {{template "errResult"}} {
+	{{- span . "delete" ""}}
+	{{- template "timeout" (timeout $ "write")}}
+	{{- audit . "delete" .PK.Param}}
+	{{template "execResult"}} r.db.{{(driver).Exec}}(ctx, {{quote (deleteSQL .)}}, {{.PK.Param}})
+	{{- template "execReturn"}}
+}
+{{end}}`
+
+	fixtureText = `{{define "fixtureRand"}}
+// fixtureRand draws fixture data. Fixtures are the same on every run and
+// machine for the same seed.
+var fixtureRand = rand.New(rand.NewSource({{(opts).Seed}}))
+
+// fixtureEpoch is the earliest time in fixture data.
+var fixtureEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// {{name "seedFixtures"}} restarts fixture data from seed. Fixture
+// functions aren't safe for concurrent use.
+func {{name "seedFixtures"}}(seed int64) {
+	fixtureRand = rand.New(rand.NewSource(seed))
+}
+{{end}}
+
+{{define "fixture"}}
+func {{name "new" .Name "fixture"}}() {{.TypeName}} {
+	var s {{.TypeName}}
+	{{- range .Fields}}{{with fixture .}}
+	{{.}}{{end}}{{end}}
+	return s
+}
+{{end}}`
+
+	namedArgsText = `{{define "namedArgs"}}
+func {{name .Name "namedArgs"}}(x {{.TypeName}}) []sql.NamedArg {
+	return []sql.NamedArg{ {{- range .Fields}}
+		sql.Named({{quote .Column}}, {{.Arg "x"}}),{{end}}
+	}
+}
+
+func {{name .Name "argMap"}}(x {{.TypeName}}) map[string]interface{} {
+	return map[string]interface{}{ {{- range .Fields}}
+		{{quote .Column}}: {{.Arg "x"}},{{end}}
+	}
+}
+{{end}}`
+
+	mapFuncsText = `{{define "mapFuncs"}}
+func {{name .Name "toMap"}}(x {{.TypeName}}) map[string]interface{} {
+	return map[string]interface{}{ {{- range .Fields}}
+		{{quote .Column}}: x.{{.Name}},{{end}}
+	}
+}
+
+func {{name .Name "fromMap"}}(m map[string]interface{}) ({{.TypeName}}, error) {
+	var x {{.TypeName}}
+	for col, v := range m {
+		var ok bool
+		switch col {
+		{{- range .Fields}}
+		case {{quote .Column}}:
+			x.{{.Name}}, ok = v.({{.QualType}})
+		{{- end}}
+		default:
+			return x, fmt.Errorf("%s: unknown column %q", {{quote .Table}}, col)
+		}
+		if !ok {
+			return x, fmt.Errorf("%s: column %q can't hold %T", {{quote .Table}}, col, v)
+		}
+	}
+	return x, nil
+}
+{{end}}`
+
+	spannerText = `{{define "spanner"}}
+{{if part "common"}}
+{{range .Helpers}}{{template "helpers" .}}{{end}}
+{{range .Enums}}{{template "enum" .}}{{end}}
+{{end}}
+{{if and .Opts.Fixtures (part "write")}}{{template "fixtureRand"}}{{end}}
+
+{{range .Tokens}}{{if part "read"}}
+// {{name .Name "spannerColumns"}} lists the columns of {{.Table}} in the order
+// {{name .Name "fromSpannerRow"}} reads them and mutations write them.
+var {{name .Name "spannerColumns"}} = []string{ {{- range $i, $f := .Fields}}{{if $i}}, {{end}}{{quote $f.Column}}{{end}}}
+
+// {{name .Name "fromSpannerRow"}} reads a row of {{name .Name "spannerColumns"}}, e.g. from
+// ReadRow(ctx, {{quote .Table}}, key, {{name .Name "spannerColumns"}}).
+func {{name .Name "fromSpannerRow"}}(row *spanner.Row) ({{.TypeName}}, error) {
+	var s {{.TypeName}}
+	{{- template "temps" .}}
+	if err := row.Columns({{template "dests" .}}
+	); err != nil {
+		return s, err
+	}
+	{{- template "assigns" .}}
+	{{- afterScan . "context.Background()" "s, err"}}
+	return s, nil
+}
+
+func {{name (print .Name "s") "fromSpannerIter"}}(iter *spanner.RowIterator) ([]{{.TypeName}}, error) {
+	var structs []{{.TypeName}}
+	err := iter.Do(func(row *spanner.Row) error {
+		s, err := {{name .Name "fromSpannerRow"}}(row)
+		if err != nil {
+			return err
+		}
+		structs = append(structs, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+{{end}}
+{{if part "write"}}
+func {{name "insert" .Name "mutation"}}(x {{.TypeName}}) *spanner.Mutation {
+	return spanner.Insert({{quote .Table}}, {{name .Name "spannerColumns"}}, {{template "spannerValues" .}})
+}
+{{if .PK}}
+func {{name "update" .Name "mutation"}}(x {{.TypeName}}) *spanner.Mutation {
+	return spanner.Update({{quote .Table}}, {{name .Name "spannerColumns"}}, {{template "spannerValues" .}})
+}
+
+func {{name "upsert" .Name "mutation"}}(x {{.TypeName}}) *spanner.Mutation {
+	return spanner.InsertOrUpdate({{quote .Table}}, {{name .Name "spannerColumns"}}, {{template "spannerValues" .}})
+}
+
+func {{name "delete" .Name "mutation"}}({{.PK.Param}} {{.PK.QualType}}) *spanner.Mutation {
+	return spanner.Delete({{quote .Table}}, spanner.Key{ {{- .PK.Param}}})
+}
+{{end}}
+{{if $.Opts.Fixtures}}{{template "fixture" .}}{{end}}
+{{if $.Opts.MapFuncs}}{{template "mapFuncs" .}}{{end}}
+{{end}}
+{{end}}{{end}}
+
+{{define "spannerValues"}}[]interface{}{ {{- range .Fields}}
+		{{.Arg "x"}},{{end}}
+	}{{end}}`
+
+	gocqlText = `{{define "gocql"}}
+{{if part "common"}}
+{{range .Helpers}}{{template "helpers" .}}{{end}}
+{{range .Enums}}{{template "enum" .}}{{end}}
+{{end}}
+{{if and .Opts.Fixtures (part "write")}}{{template "fixtureRand"}}{{end}}
+
+{{range .Tokens}}{{if part "read"}}
+const {{name "select" .Name}} = {{quote (print "SELECT " (cqlColumns .) " FROM " .Table)}}
+
+// {{name "scan" .Name}} scans the row q selects with {{name "select" .Name}}. It
+// returns gocql.ErrNotFound when there's none.
+func {{name "scan" .Name}}(q *gocql.Query) ({{.TypeName}}, error) {
+	var s {{.TypeName}}
+	{{- template "temps" .}}
+	if err := q.Scan({{template "dests" .}}
+	); err != nil {
+		return s, err
+	}
+	{{- template "assigns" .}}
+	{{- afterScan . "context.Background()" "s, err"}}
+	return s, nil
+}
+
+// {{name "scan" (print .Name "s")}} scans the rows of iter, selected with {{name "select" .Name}},
+// and closes it.
+func {{name "scan" (print .Name "s")}}(iter *gocql.Iter) ([]{{.TypeName}}, error) {
+	structs := make([]{{.TypeName}}, 0, 16)
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		var s {{.TypeName}}
+		{{- template "temps" .}}
+		if err := scanner.Scan({{template "dests" .}}
+		); err != nil {
+			iter.Close()
+			return nil, err
+		}
+		{{- template "assigns" .}}
+		{{- afterScan . "context.Background()" "nil, err"}}
+		structs = append(structs, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return structs, nil
+}
+{{end}}
+{{if part "write"}}
+const {{name "insert" .Name "CQL"}} = {{quote (print "INSERT INTO " .Table " (" (cqlColumns .) ") VALUES (" (cqlMarks .) ")")}}
+
+// {{name .Name "values"}} returns the values {{name "insert" .Name "CQL"}} binds.
+func {{name .Name "values"}}(x {{.TypeName}}) []interface{} {
+	return []interface{}{ {{- range .Fields}}
+		{{.Arg "x"}},{{end}}
+	}
+}
+
+func {{name "insert" .Name}}(ctx context.Context, session *gocql.Session, x {{.TypeName}}) error {
+	{{- validate . "err"}}
+	return session.Query({{name "insert" .Name "CQL"}}, {{name .Name "values"}}(x)...).WithContext(ctx).Exec()
+}
+{{if $.Opts.Fixtures}}{{template "fixture" .}}{{end}}
+{{if $.Opts.MapFuncs}}{{template "mapFuncs" .}}{{end}}
+{{end}}
+{{end}}{{end}}`
+
+	helpersText = `{{define "helpers"}}{{if eq . "hstore"}}
+func hstoreToMap(h pgtype.Hstore) map[string]string {
+	if h == nil {
+		return nil
+	}
+	m := make(map[string]string, len(h))
+	for k, v := range h {
+		if v != nil {
+			m[k] = *v
+		}
+	}
+	return m
+}
+
+func mapToHstore(m map[string]string) pgtype.Hstore {
+	if m == nil {
+		return nil
+	}
+	h := make(pgtype.Hstore, len(m))
+	for k, v := range m {
+		v := v
+		h[k] = &v
+	}
+	return h
+}
+{{else if eq . "sqliteBool"}}
+// sqliteBool scans booleans SQLite stores as integers or text.
+type sqliteBool bool
+
+func (b *sqliteBool) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case bool:
+		*b = sqliteBool(v)
+	case int64:
+		*b = v != 0
+	case float64:
+		*b = v != 0
+	case []byte:
+		return b.Scan(string(v))
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("can't scan %q into bool", v)
+		}
+		*b = sqliteBool(parsed)
+	default:
+		return fmt.Errorf("can't scan %T into bool", src)
+	}
+	return nil
+}
+{{else if eq . "sqliteTime"}}
+// sqliteTime scans times SQLite stores as text or Unix seconds.
+type sqliteTime time.Time
+
+// sqliteTimeFormats are the text forms of SQLite times, most precise first.
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func (t *sqliteTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*t = sqliteTime(v)
+	case int64:
+		*t = sqliteTime(time.Unix(v, 0).UTC())
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		v = strings.TrimSuffix(v, "Z")
+		for _, format := range sqliteTimeFormats {
+			if parsed, err := time.ParseInLocation(format, v, time.UTC); err == nil {
+				*t = sqliteTime(parsed)
+				return nil
+			}
+		}
+		return fmt.Errorf("can't scan %q into time.Time", v)
+	default:
+		return fmt.Errorf("can't scan %T into time.Time", src)
+	}
+	return nil
+}
 {{end}}{{end}}`
 )